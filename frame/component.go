@@ -0,0 +1,201 @@
+package frame
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/xbonlinenet/goup/frame/health"
+	"github.com/xbonlinenet/goup/frame/log"
+)
+
+// Component 由框架管理生命周期的组件，初始化框架时按依赖顺序启动，退出时按相反的顺序停止
+type Component interface {
+	// Name 组件名称，不能重复
+	Name() string
+	// DependsOn 依赖的组件名称，依赖的组件启动之后才启动
+	DependsOn() []string
+	// Start 启动组件，返回错误时框架初始化失败
+	Start(ctx context.Context) error
+	// Stop 停止组件，ctx 超时后不再等待
+	Stop(ctx context.Context) error
+	// Health 健康检查，注册为就绪检查项 component.<name>；内置组件使用每个连接的检查项（db.<name> 等）
+	Health(ctx context.Context) error
+}
+
+// flusher 退出时在关闭数据连接之前发送缓存的数据，如 Kafka 异步生产者
+type flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// componentStartSeconds 组件启动的耗时
+var componentStartSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "component_start_seconds",
+	Help: "component start duration in seconds",
+}, []string{"component"})
+
+// componentStartFailedCounter 组件启动失败的次数
+var componentStartFailedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "component_start_failed",
+	Help: "component start failure count",
+}, []string{"component"})
+
+func init() {
+	prometheus.MustRegister(componentStartSeconds, componentStartFailedCounter)
+}
+
+var (
+	componentMutex sync.Mutex
+	// components 注册的组件，按注册的顺序保存
+	components []Component
+	// startedComponents 已经启动的组件，按启动的顺序保存
+	startedComponents []Component
+)
+
+// RegisterComponent 注册组件，需要在框架初始化之前调用。内置的 DB、Redis、ES、Kafka 组件名称为 db、redis、es、kafka
+func RegisterComponent(c Component) {
+	componentMutex.Lock()
+	defer componentMutex.Unlock()
+
+	for _, registered := range components {
+		if registered.Name() == c.Name() {
+			panic(fmt.Errorf("component %s already registered", c.Name()))
+		}
+	}
+	components = append(components, c)
+}
+
+// registerBuiltinComponents 内置组件在业务组件之前注册，没有依赖关系时先启动
+func registerBuiltinComponents(builtins []Component) {
+	componentMutex.Lock()
+	defer componentMutex.Unlock()
+	components = append(builtins, components...)
+}
+
+// sortComponents 按依赖排序，没有依赖关系的组件保持注册的顺序
+func sortComponents(list []Component) ([]Component, error) {
+	byName := make(map[string]Component, len(list))
+	for _, c := range list {
+		byName[c.Name()] = c
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(list))
+	sorted := make([]Component, 0, len(list))
+
+	var visit func(c Component, path []string) error
+	visit = func(c Component, path []string) error {
+		name := c.Name()
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("component dependency cycle: %s", strings.Join(append(path, name), " -> "))
+		}
+		state[name] = visiting
+		for _, dep := range c.DependsOn() {
+			depComponent, ok := byName[dep]
+			if !ok {
+				return fmt.Errorf("component %s depends on %s, which is not registered or disabled", name, dep)
+			}
+			if err := visit(depComponent, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		sorted = append(sorted, c)
+		return nil
+	}
+
+	for _, c := range list {
+		if err := visit(c, nil); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// startComponents 按依赖顺序启动组件，启动失败时停止已经启动的组件，之后 UnInitFramework 不会再次停止
+func startComponents(ctx context.Context) error {
+	componentMutex.Lock()
+	sorted, err := sortComponents(components)
+	componentMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range sorted {
+		if err := startComponent(ctx, c); err != nil {
+			stopComponents(shutdownDuration("close_timeout", defaultCloseTimeout))
+			return err
+		}
+	}
+	return nil
+}
+
+func startComponent(ctx context.Context, c Component) (err error) {
+	name := c.Name()
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+		elapsed := time.Since(start)
+		if err != nil {
+			componentStartFailedCounter.WithLabelValues(name).Inc()
+			log.Default().Error("component start failed", zap.String("component", name), zap.Duration("elapsed", elapsed), zap.Error(err))
+			err = fmt.Errorf("start component %s: %w", name, err)
+			return
+		}
+		componentStartSeconds.WithLabelValues(name).Set(elapsed.Seconds())
+		log.Default().Info("component started", zap.String("component", name), zap.Duration("elapsed", elapsed))
+	}()
+
+	if err = c.Start(ctx); err != nil {
+		return err
+	}
+
+	componentMutex.Lock()
+	startedComponents = append(startedComponents, c)
+	componentMutex.Unlock()
+	// 内置的数据组件每个连接单独注册了检查项，不再注册组件的检查项
+	if _, ok := c.(*dataComponent); !ok {
+		health.Register("component."+name, c.Health)
+	}
+	return nil
+}
+
+// flushComponents 按启动相反的顺序执行组件的 Flush，每个组件最多等待 timeout
+func flushComponents(timeout time.Duration) {
+	componentMutex.Lock()
+	started := startedComponents
+	componentMutex.Unlock()
+
+	for i := len(started) - 1; i >= 0; i-- {
+		if f, ok := started[i].(flusher); ok {
+			runShutdownPhase("flush "+started[i].Name(), timeout, f.Flush)
+		}
+	}
+}
+
+// stopComponents 按启动相反的顺序停止组件，每个组件最多等待 timeout；已经停止的组件不会再次停止
+func stopComponents(timeout time.Duration) {
+	componentMutex.Lock()
+	started := startedComponents
+	startedComponents = nil
+	componentMutex.Unlock()
+
+	for i := len(started) - 1; i >= 0; i-- {
+		c := started[i]
+		health.Unregister("component." + c.Name())
+		runShutdownPhase("component "+c.Name(), timeout, c.Stop)
+	}
+}
@@ -0,0 +1,105 @@
+package frame
+
+import (
+	"context"
+
+	"github.com/spf13/viper"
+
+	"github.com/xbonlinenet/goup/frame/data"
+)
+
+// dataComponent 内置的数据组件，每个连接注册了 db.<name>、redis.<name> 等检查项，Health 不会注册为检查项
+type dataComponent struct {
+	name  string
+	start func(ctx context.Context) error
+	stop  func(ctx context.Context) error
+	// flush 退出时在关闭数据连接之前发送缓存的数据，可以为空
+	flush func(ctx context.Context) error
+}
+
+func (c *dataComponent) Name() string { return c.name }
+
+func (c *dataComponent) DependsOn() []string { return nil }
+
+func (c *dataComponent) Start(ctx context.Context) error { return c.start(ctx) }
+
+func (c *dataComponent) Stop(ctx context.Context) error { return c.stop(ctx) }
+
+func (c *dataComponent) Flush(ctx context.Context) error {
+	if c.flush == nil {
+		return nil
+	}
+	return c.flush(ctx)
+}
+
+func (c *dataComponent) Health(ctx context.Context) error { return nil }
+
+// dataComponents 根据配置和 Disable*Init 选项创建内置的数据组件
+func dataComponents(serverConfig *bootstarpServerConfig) []Component {
+	var list []Component
+
+	callInitFuncByConfigCondition(func() {
+		list = append(list, &dataComponent{
+			name: "db",
+			start: func(ctx context.Context) error {
+				data.InitSQLMgr(serverConfig.customSqlConf)
+
+				// 设置 DB 错误回调
+				if serverConfig.dbErrorCallback == nil && viper.GetBool("goup.db.default_error_callback") {
+					serverConfig.dbErrorCallback = DefaultDbErrorCallback
+				}
+				data.SetDbErrorCallback(serverConfig.dbErrorCallback)
+				return nil
+			},
+			stop: func(ctx context.Context) error {
+				data.UnInitSQLMgr()
+				return nil
+			},
+		})
+	}, "data.InitSQLMgr", serverConfig.initDbDisabled, "data.db")
+
+	callInitFuncByConfigCondition(func() {
+		list = append(list, &dataComponent{
+			name: "redis",
+			start: func(ctx context.Context) error {
+				data.InitRedisMgr(serverConfig.custonRedisConf)
+				return nil
+			},
+			stop: func(ctx context.Context) error {
+				data.UninitRedisMgr()
+				return nil
+			},
+		})
+	}, "data.InitRedisMgr", serverConfig.initRedisDisabled, "data.redis")
+
+	callInitFuncByConfigCondition(func() {
+		list = append(list, &dataComponent{
+			name: "es",
+			start: func(ctx context.Context) error {
+				data.InitESMgr()
+				return nil
+			},
+			stop: func(ctx context.Context) error {
+				data.UninitESMgr()
+				return nil
+			},
+		})
+	}, "data.InitESMgr", serverConfig.initEsDisabled, "data.es")
+
+	callInitFuncByConfigCondition(func() {
+		list = append(list, &dataComponent{
+			name: "kafka",
+			start: func(ctx context.Context) error {
+				data.InitKafka(ctx)
+				return nil
+			},
+			// 异步生产者在 flush 阶段发送缓存的消息并关闭
+			stop: func(ctx context.Context) error {
+				return nil
+			},
+			flush: data.CloseAsyncProducer,
+		})
+	}, "data.InitKafka", serverConfig.initKafkaDisabled, "data.kafka")
+
+	return list
+}
@@ -0,0 +1,146 @@
+package frame
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xbonlinenet/goup/frame/health"
+)
+
+type testComponent struct {
+	name     string
+	deps     []string
+	startErr error
+	events   *[]string
+}
+
+func (c *testComponent) Name() string        { return c.name }
+func (c *testComponent) DependsOn() []string { return c.deps }
+
+func (c *testComponent) Start(ctx context.Context) error {
+	if c.startErr != nil {
+		return c.startErr
+	}
+	*c.events = append(*c.events, "start "+c.name)
+	return nil
+}
+
+func (c *testComponent) Stop(ctx context.Context) error {
+	*c.events = append(*c.events, "stop "+c.name)
+	return nil
+}
+
+func (c *testComponent) Health(ctx context.Context) error { return nil }
+
+func resetComponents() {
+	components = nil
+	startedComponents = nil
+}
+
+func TestSortComponents(t *testing.T) {
+	cases := []struct {
+		list  []Component
+		order []string
+		err   string
+	}{
+		{
+			list: []Component{
+				&testComponent{name: "search", deps: []string{"db", "redis"}},
+				&testComponent{name: "db"},
+				&testComponent{name: "redis"},
+				&testComponent{name: "cache", deps: []string{"redis"}},
+			},
+			order: []string{"db", "redis", "search", "cache"},
+		},
+		{
+			list: []Component{&testComponent{name: "search", deps: []string{"es"}}},
+			err:  "search depends on es",
+		},
+		{
+			list: []Component{
+				&testComponent{name: "a", deps: []string{"b"}},
+				&testComponent{name: "b", deps: []string{"a"}},
+			},
+			err: "cycle: a -> b -> a",
+		},
+	}
+	for _, tc := range cases {
+		sorted, err := sortComponents(tc.list)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error %q, got %v", tc.err, err)
+			}
+			continue
+		}
+		var order []string
+		for _, c := range sorted {
+			order = append(order, c.Name())
+		}
+		if err != nil || !reflect.DeepEqual(order, tc.order) {
+			t.Errorf("unexpected order %v %v", order, err)
+		}
+	}
+}
+
+func TestStartAndStopComponents(t *testing.T) {
+	resetComponents()
+	defer resetComponents()
+
+	var events []string
+	RegisterComponent(&testComponent{name: "search", deps: []string{"db"}, events: &events})
+	registerBuiltinComponents([]Component{&testComponent{name: "db", events: &events}})
+
+	if err := startComponents(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	stopComponents(defaultCloseTimeout)
+	// 再次调用不会重复停止
+	stopComponents(defaultCloseTimeout)
+	expected := []string{"start db", "start search", "stop search", "stop db"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("unexpected events %v", events)
+	}
+
+	// 启动失败时停止已经启动的组件
+	resetComponents()
+	events = nil
+	RegisterComponent(&testComponent{name: "db", events: &events})
+	RegisterComponent(&testComponent{name: "search", deps: []string{"db"}, startErr: errors.New("boom"), events: &events})
+	if err := startComponents(context.Background()); err == nil || !strings.Contains(err.Error(), "search") {
+		t.Fatalf("expected start error, got %v", err)
+	}
+	// 初始化失败后 UnInitFramework 不会重复停止
+	stopComponents(defaultCloseTimeout)
+	expected = []string{"start db", "stop db"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("unexpected events %v", events)
+	}
+}
+
+func TestComponentHealthRegistration(t *testing.T) {
+	resetComponents()
+	defer resetComponents()
+
+	var events []string
+	registerBuiltinComponents([]Component{&dataComponent{
+		name:  "db",
+		start: func(ctx context.Context) error { return nil },
+		stop:  func(ctx context.Context) error { return nil },
+	}})
+	RegisterComponent(&testComponent{name: "search", events: &events})
+	if err := startComponents(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer stopComponents(defaultCloseTimeout)
+
+	report := health.Ready(context.Background())
+	if _, ok := report.Checks["component.db"]; ok {
+		t.Error("builtin component should not register a no-op check")
+	}
+	if _, ok := report.Checks["component.search"]; !ok {
+		t.Error("component check should be registered")
+	}
+}
@@ -75,11 +75,13 @@ func InitSQLMgr(custom map[string]*SQLConfig) {
 		custom[item] = config
 	}
 	sqlMgr = newSQLDBMgr(custom)
+	registerSQLHealthChecks(sqlMgr)
 }
 
 // UnInitSQLMgr 反初始化 sqlMgr 相关
 func UnInitSQLMgr() {
 	if sqlMgr != nil {
+		unregisterSQLHealthChecks(sqlMgr)
 		sqlMgr.Close()
 		sqlMgr = nil
 	}
@@ -399,6 +401,7 @@ func (mgr *SQLDBMgr) initDBConn(config *SQLConfig, name string) (*dbConn, error)
 
 	// 注册错误回调
 	mgr.registerErrorCallbackOnDb(name, db)
+	registerTraceCallbacksOnDb(name, config.Type, db)
 
 	return conn, nil
 }
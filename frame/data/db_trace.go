@@ -0,0 +1,78 @@
+package data
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/xbonlinenet/goup/frame/tracing"
+)
+
+const (
+	dbTraceContextKey = "goup:trace_context"
+	dbTraceSpanKey    = "goup:trace_span"
+)
+
+// DBWithContext 关联 ctx 中的 Span，之后执行的 SQL 作为子 Span 记录
+//
+//	data.DBWithContext(c, data.MustGetDB("default")).Where("id = ?", id).First(&user)
+func DBWithContext(ctx context.Context, db *gorm.DB) *gorm.DB {
+	return db.Set(dbTraceContextKey, ctx)
+}
+
+// registerTraceCallbacksOnDb 为每条 SQL 创建 Span，SQL 中不包含参数的值
+func registerTraceCallbacksOnDb(name, dbType string, db *gorm.DB) {
+	system := semconv.DBSystemMySQL
+	if dbType == DBTypePostgres {
+		system = semconv.DBSystemPostgreSQL
+	}
+
+	before := func(operation string) func(scope *gorm.Scope) {
+		return func(scope *gorm.Scope) {
+			ctx := context.Background()
+			if v, ok := scope.Get(dbTraceContextKey); ok {
+				if c, ok := v.(context.Context); ok && c != nil {
+					ctx = c
+				}
+			}
+			_, span := tracing.Start(ctx, "gorm."+operation,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					system,
+					semconv.DBNameKey.String(name),
+					semconv.DBOperationKey.String(operation),
+					semconv.DBSQLTableKey.String(scope.TableName()),
+				))
+			scope.InstanceSet(dbTraceSpanKey, span)
+		}
+	}
+
+	after := func(scope *gorm.Scope) {
+		v, ok := scope.InstanceGet(dbTraceSpanKey)
+		if !ok {
+			return
+		}
+		span := v.(trace.Span)
+		span.SetAttributes(semconv.DBStatementKey.String(scope.SQL))
+		if err := scope.DB().Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+
+	callback := db.Callback()
+	callback.Create().Before("gorm:begin_transaction").Register("goup:trace:before_create", before("create"))
+	callback.Create().After("gorm:commit_or_rollback_transaction").Register("goup:trace:after_create", after)
+	callback.Update().Before("gorm:begin_transaction").Register("goup:trace:before_update", before("update"))
+	callback.Update().After("gorm:commit_or_rollback_transaction").Register("goup:trace:after_update", after)
+	callback.Delete().Before("gorm:begin_transaction").Register("goup:trace:before_delete", before("delete"))
+	callback.Delete().After("gorm:commit_or_rollback_transaction").Register("goup:trace:after_delete", after)
+	callback.Query().Before("gorm:query").Register("goup:trace:before_query", before("query"))
+	callback.Query().After("gorm:after_query").Register("goup:trace:after_query", after)
+	callback.RowQuery().Before("gorm:row_query").Register("goup:trace:before_row_query", before("row_query"))
+	callback.RowQuery().After("gorm:row_query").Register("goup:trace:after_row_query", after)
+}
@@ -35,6 +35,7 @@ type ESClientMgr struct {
 // InitESMgr 初始化ESMgr
 func InitESMgr() {
 	esClientMgr = newESClientMgr(viper.Sub("data.es"))
+	registerESHealthChecks(esClientMgr)
 }
 
 // newESClientMgr 根据配置创建新的数据库连接管理
@@ -50,6 +51,7 @@ func newESClientMgr(conf *viper.Viper) *ESClientMgr {
 // UninitESMgr 反初始化 ES 相关
 func UninitESMgr() {
 	if esClientMgr != nil {
+		unregisterESHealthChecks(esClientMgr)
 		esClientMgr.Close()
 		esClientMgr = nil
 	}
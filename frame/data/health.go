@@ -0,0 +1,107 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/spf13/viper"
+
+	"github.com/xbonlinenet/goup/frame/health"
+)
+
+// 健康检查项的名称，DB、Redis、ES 为 <前缀>.<配置名>
+const (
+	healthCheckDBPrefix    = "db."
+	healthCheckRedisPrefix = "redis."
+	healthCheckESPrefix    = "es."
+	healthCheckKafka       = "kafka"
+)
+
+// registerSQLHealthChecks 为每个配置的数据库注册检查项
+func registerSQLHealthChecks(mgr *SQLDBMgr) {
+	for name := range mgr.dbConfig {
+		name := name
+		health.Register(healthCheckDBPrefix+name, func(ctx context.Context) error {
+			db, err := mgr.getDB(name)
+			if err != nil {
+				return err
+			}
+			return db.DB().PingContext(ctx)
+		})
+	}
+}
+
+func unregisterSQLHealthChecks(mgr *SQLDBMgr) {
+	for name := range mgr.dbConfig {
+		health.Unregister(healthCheckDBPrefix + name)
+	}
+}
+
+// registerRedisHealthChecks 为每个配置的 Redis 注册检查项
+func registerRedisHealthChecks(mgr *RedisMgr) {
+	for name := range mgr.redisConfig {
+		name := name
+		health.Register(healthCheckRedisPrefix+name, func(ctx context.Context) error {
+			client, err := mgr.getRedis(name)
+			if err != nil {
+				return err
+			}
+			return client.Ping().Err()
+		})
+	}
+}
+
+func unregisterRedisHealthChecks(mgr *RedisMgr) {
+	for name := range mgr.redisConfig {
+		health.Unregister(healthCheckRedisPrefix + name)
+	}
+}
+
+// registerESHealthChecks 为每个配置的 ES 注册检查项，任意一个节点可以访问即为正常
+func registerESHealthChecks(mgr *ESClientMgr) {
+	for name := range mgr.dbConfig.AllSettings() {
+		name := name
+		health.Register(healthCheckESPrefix+name, func(ctx context.Context) error {
+			client, err := mgr.getESClient(name)
+			if err != nil {
+				return err
+			}
+			for _, url := range mgr.dbConfig.Sub(name).GetStringSlice("url") {
+				if _, _, err = client.Ping(url).Do(ctx); err == nil {
+					return nil
+				}
+			}
+			return err
+		})
+	}
+}
+
+func unregisterESHealthChecks(mgr *ESClientMgr) {
+	for name := range mgr.dbConfig.AllSettings() {
+		health.Unregister(healthCheckESPrefix + name)
+	}
+}
+
+// registerKafkaHealthCheck 生产者使用的 broker 中任意一个可以连接即为正常
+func registerKafkaHealthCheck() {
+	brokers := viper.GetStringSlice("data.kafka.brokers")
+	if len(brokers) == 0 {
+		return
+	}
+	health.Register(healthCheckKafka, func(ctx context.Context) error {
+		return dialAny(ctx, brokers)
+	})
+}
+
+func dialAny(ctx context.Context, addrs []string) error {
+	err := errors.New("no address")
+	var dialer net.Dialer
+	for _, addr := range addrs {
+		var conn net.Conn
+		if conn, err = dialer.DialContext(ctx, "tcp", addr); err == nil {
+			return conn.Close()
+		}
+	}
+	return err
+}
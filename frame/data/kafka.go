@@ -19,6 +19,7 @@ var kafkaCtx context.Context
 
 func InitKafka(ctx context.Context) {
 	kafkaCtx = ctx
+	registerKafkaHealthCheck()
 }
 
 // ErrKafkaNoBrokers brokers 未配置错误
@@ -112,10 +113,7 @@ var aSyncProducer sarama.AsyncProducer
 var aonce sync.Once
 
 func MustGetAsyncProducer() sarama.AsyncProducer {
-	if aSyncProducer != nil {
-		return aSyncProducer
-	}
-
+	// aonce 同时保证读取 aSyncProducer 时已经初始化完成
 	aonce.Do(func() {
 		producer, err := NewAsyncProducer()
 		if err != nil {
@@ -144,6 +142,27 @@ func MustGetAsyncProducer() sarama.AsyncProducer {
 	return aSyncProducer
 }
 
+// CloseAsyncProducer 发送缓存的消息并关闭 MustGetAsyncProducer 创建的生产者，ctx 结束时不再等待
+func CloseAsyncProducer(ctx context.Context) error {
+	// 通过 aonce 读取，等待正在进行的初始化完成；没有创建时之后也不再创建
+	aonce.Do(func() {})
+	producer := aSyncProducer
+	if producer == nil {
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- producer.Close()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func KafkaConsume(signals chan os.Signal, topic, groupID string, errCallback func(err error), callback func(msgBytes []byte)) {
 	kafkaConsumer, err := NewConsumerWithNewestOffset([]string{topic}, groupID)
 	if err != nil {
@@ -174,7 +193,9 @@ func KafkaConsume(signals chan os.Signal, topic, groupID string, errCallback fun
 			}
 
 			kafkaConsumer.MarkOffset(msg, "") // mark message as processed
-			callback(msg.Value)
+			consumeWithTrace(context.Background(), groupID, msg, func(context.Context) {
+				callback(msg.Value)
+			})
 		case <-signals:
 			return
 		}
@@ -213,7 +234,9 @@ func KafkaConsumeV1(signals chan os.Signal, topics []string, groupID string, err
 			}
 
 			kafkaConsumer.MarkOffset(msg, "") // mark message as processed
-			callback(msg.Value)
+			consumeWithTrace(context.Background(), groupID, msg, func(context.Context) {
+				callback(msg.Value)
+			})
 		case s := <-signals:
 			signals <- s
 			fmt.Println("stop starting....", len(signals))
@@ -255,7 +278,9 @@ func KafkaConsumeV2(signals chan os.Signal, topics []string, groupID string, err
 			}
 
 			kafkaConsumer.MarkOffset(msg, "") // mark message as processed
-			callback(msg.Value)
+			consumeWithTrace(context.Background(), groupID, msg, func(context.Context) {
+				callback(msg.Value)
+			})
 		case s := <-signals:
 			signals <- s
 			fmt.Println("stop starting....", len(signals))
@@ -293,11 +318,60 @@ func KafkaConsumeV3(ctx context.Context, topics []string, groupID string, errCal
 		select {
 		case msg, ok := <-kafkaConsumer.Messages():
 			if !ok {
-				break
+				// 消费者已经关闭
+				finishCallback()
+				return
+			}
+
+			kafkaConsumer.MarkOffset(msg, "") // mark message as processed
+			consumeWithTrace(ctx, groupID, msg, func(context.Context) {
+				callback(msg.Value)
+			})
+		case <-ctx.Done():
+			fmt.Println("stop starting....", ctx.Err())
+			finishCallback()
+			return
+		}
+	}
+}
+
+// KafkaConsumeV4 带处理context停止信号和链路追踪的 kafka 消费，callback 的 ctx 中带有消息的 Span，ctx 取消时 callback 的 ctx 也会取消
+func KafkaConsumeV4(ctx context.Context, topics []string, groupID string, errCallback func(err error),
+	callback func(ctx context.Context, msg *sarama.ConsumerMessage), finishCallback func()) {
+	kafkaConsumer, err := NewConsumerWithNewestOffset(topics, groupID)
+	if err != nil {
+		panic(err)
+	}
+
+	defer kafkaConsumer.Close()
+
+	// consume errors
+	go func() {
+		for err := range kafkaConsumer.Errors() {
+			errCallback(err)
+		}
+	}()
+
+	// consume notifications
+	go func() {
+		for range kafkaConsumer.Notifications() {
+		}
+	}()
+
+	// consume messages, watch signals
+	for {
+		select {
+		case msg, ok := <-kafkaConsumer.Messages():
+			if !ok {
+				// 消费者已经关闭
+				finishCallback()
+				return
 			}
 
 			kafkaConsumer.MarkOffset(msg, "") // mark message as processed
-			callback(msg.Value)
+			consumeWithTrace(ctx, groupID, msg, func(msgCtx context.Context) {
+				callback(msgCtx, msg)
+			})
 		case <-ctx.Done():
 			fmt.Println("stop starting....", ctx.Err())
 			finishCallback()
@@ -0,0 +1,111 @@
+package data
+
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/xbonlinenet/goup/frame/tracing"
+)
+
+// producerHeaderCarrier 在消息头中传递 traceparent
+type producerHeaderCarrier struct {
+	msg *sarama.ProducerMessage
+}
+
+func (c producerHeaderCarrier) Get(key string) string {
+	for _, h := range c.msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c producerHeaderCarrier) Set(key, value string) {
+	for i, h := range c.msg.Headers {
+		if string(h.Key) == key {
+			c.msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.msg.Headers = append(c.msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func (c producerHeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for _, h := range c.msg.Headers {
+		keys = append(keys, string(h.Key))
+	}
+	return keys
+}
+
+type consumerHeaderCarrier []*sarama.RecordHeader
+
+func (c consumerHeaderCarrier) Get(key string) string {
+	for _, h := range c {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Set 消费时只读取消息头
+func (c consumerHeaderCarrier) Set(key, value string) {}
+
+func (c consumerHeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for _, h := range c {
+		if h != nil {
+			keys = append(keys, string(h.Key))
+		}
+	}
+	return keys
+}
+
+// startProducerSpan 创建发送消息的 Span，并写入消息头
+func startProducerSpan(ctx context.Context, msg *sarama.ProducerMessage) trace.Span {
+	ctx, span := tracing.Start(ctx, msg.Topic+" send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("kafka"),
+			semconv.MessagingDestinationNameKey.String(msg.Topic),
+		))
+	otel.GetTextMapPropagator().Inject(ctx, producerHeaderCarrier{msg: msg})
+	return span
+}
+
+// SendMessage 使用同步生产者发送消息，消息头中带有 ctx 中的 Span
+func SendMessage(ctx context.Context, producer sarama.SyncProducer, msg *sarama.ProducerMessage) (int32, int64, error) {
+	span := startProducerSpan(ctx, msg)
+	partition, offset, err := producer.SendMessage(msg)
+	tracing.End(span, err)
+	return partition, offset, err
+}
+
+// AsyncSendMessage 使用异步生产者发送消息，消息头中带有 ctx 中的 Span，Span 在消息进入发送队列时结束
+func AsyncSendMessage(ctx context.Context, producer sarama.AsyncProducer, msg *sarama.ProducerMessage) {
+	span := startProducerSpan(ctx, msg)
+	producer.Input() <- msg
+	span.End()
+}
+
+// consumeWithTrace 使用消息头中的 Span 作为父 Span 处理消息
+func consumeWithTrace(ctx context.Context, groupID string, msg *sarama.ConsumerMessage, handle func(ctx context.Context)) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, consumerHeaderCarrier(msg.Headers))
+	ctx, span := tracing.Start(ctx, msg.Topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("kafka"),
+			semconv.MessagingSourceNameKey.String(msg.Topic),
+			semconv.MessagingKafkaConsumerGroupKey.String(groupID),
+			semconv.MessagingKafkaSourcePartitionKey.Int64(int64(msg.Partition)),
+			semconv.MessagingKafkaMessageOffsetKey.Int64(msg.Offset),
+		))
+	defer span.End()
+	handle(ctx)
+}
@@ -84,11 +84,13 @@ func InitRedisMgr(custom map[string]*RedisConfig) {
 	}
 
 	redisMgr = newRedisMgr(custom)
+	registerRedisHealthChecks(redisMgr)
 }
 
 // UninitRedisMgr 反初始化 Redis 相关
 func UninitRedisMgr() {
 	if redisMgr != nil {
+		unregisterRedisHealthChecks(redisMgr)
 		redisMgr.Close()
 		redisMgr = nil
 	}
@@ -0,0 +1,81 @@
+package data
+
+import (
+	"context"
+
+	"github.com/go-redis/redis"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/xbonlinenet/goup/frame/tracing"
+)
+
+// GetRedisWithContext 获取 redis，执行的命令作为 ctx 中 Span 的子 Span 记录
+//
+// 返回的是带有 ctx 的浅拷贝，连接池和原来的实例共享，只在当前请求中使用
+func GetRedisWithContext(ctx context.Context, name string) (redis.Cmdable, error) {
+	client, err := GetRedis(name)
+	if err != nil {
+		return nil, err
+	}
+	return redisWithTrace(ctx, name, client), nil
+}
+
+func redisWithTrace(ctx context.Context, name string, client redis.Cmdable) redis.Cmdable {
+	switch c := client.(type) {
+	case *redis.Client:
+		c = c.WithContext(ctx)
+		c.WrapProcess(traceRedisProcess(ctx, name))
+		c.WrapProcessPipeline(traceRedisPipeline(ctx, name))
+		return c
+	case *redis.ClusterClient:
+		c = c.WithContext(ctx)
+		c.WrapProcess(traceRedisProcess(ctx, name))
+		c.WrapProcessPipeline(traceRedisPipeline(ctx, name))
+		return c
+	}
+	return client
+}
+
+// startRedisSpan 只记录命令的名称，不记录参数
+func startRedisSpan(ctx context.Context, name, operation string, attrs ...attribute.KeyValue) trace.Span {
+	attrs = append(attrs,
+		semconv.DBSystemRedis,
+		semconv.DBNameKey.String(name),
+		semconv.DBOperationKey.String(operation),
+	)
+	_, span := tracing.Start(ctx, "redis."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return span
+}
+
+func endRedisSpan(span trace.Span, err error) {
+	if err != nil && err != redis.Nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func traceRedisProcess(ctx context.Context, name string) func(old func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
+	return func(old func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			span := startRedisSpan(ctx, name, cmd.Name())
+			err := old(cmd)
+			endRedisSpan(span, err)
+			return err
+		}
+	}
+}
+
+func traceRedisPipeline(ctx context.Context, name string) func(old func(cmds []redis.Cmder) error) func(cmds []redis.Cmder) error {
+	return func(old func(cmds []redis.Cmder) error) func(cmds []redis.Cmder) error {
+		return func(cmds []redis.Cmder) error {
+			span := startRedisSpan(ctx, name, "pipeline", attribute.Int("db.redis.commands", len(cmds)))
+			err := old(cmds)
+			endRedisSpan(span, err)
+			return err
+		}
+	}
+}
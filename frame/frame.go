@@ -20,6 +20,7 @@ import (
 	"github.com/xbonlinenet/goup/frame/data"
 	"github.com/xbonlinenet/goup/frame/dyncfg"
 	"github.com/xbonlinenet/goup/frame/log"
+	"github.com/xbonlinenet/goup/frame/tracing"
 	"github.com/xbonlinenet/goup/frame/util"
 )
 
@@ -86,25 +87,14 @@ func initFrameWorkImpl(serverConfig *bootstarpServerConfig) {
 
 	util.InitGlobeInfo()
 
-	callInitFuncByConfigCondition(func() {
-		data.InitSQLMgr(serverConfig.customSqlConf)
-
-		// 设置 DB 错误回调
-		if serverConfig.dbErrorCallback == nil && viper.GetBool("goup.db.default_error_callback") {
-			serverConfig.dbErrorCallback = DefaultDbErrorCallback
-		}
-		data.SetDbErrorCallback(serverConfig.dbErrorCallback)
-
-	}, "data.InitSQLMgr", serverConfig.initDbDisabled, "data.db")
-
-	callInitFuncByConfigCondition(func() {
-		data.InitRedisMgr(serverConfig.custonRedisConf)
-	}, "data.InitRedisMgr", serverConfig.initRedisDisabled, "data.redis")
+	// 链路追踪，资源中使用 util 中的主机名
+	err = tracing.Init()
+	util.CheckError(err)
 
-	callInitFuncByConfigCondition(data.InitESMgr, "data.InitESMgr", serverConfig.initEsDisabled, "data.es")
-	callInitFuncByConfigCondition(func() {
-		data.InitKafka(ctx)
-	}, "data.InitKafka", serverConfig.initKafkaDisabled, "data.kafka")
+	// 启动内置的数据组件和业务注册的组件
+	registerBuiltinComponents(dataComponents(serverConfig))
+	err = startComponents(ctx)
+	util.CheckError(err)
 
 	users := viper.GetStringSlice("alter.users")
 	robotUrls := viper.GetStringSlice("alter.robot-urls")
@@ -188,10 +178,7 @@ func UnInitFramework() {
 	}
 	cost := time.Now().Unix() - start
 	log.Default().Info(fmt.Sprintf("Total Cost: %d", cost))
-	cc.UnInitConfigCenter()
-	data.UnInitSQLMgr()
-	data.UninitRedisMgr()
-	data.UninitESMgr()
+	shutdownFramework()
 
 	cancel()
 }
@@ -0,0 +1,261 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	stdjson "encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/xbonlinenet/goup/frame/perf"
+	"github.com/xbonlinenet/goup/frame/tracing"
+)
+
+// 批量接口的默认配置
+const (
+	batchKey                = "_batch"
+	defaultBatchMaxItems    = 20
+	defaultBatchConcurrency = 5
+	defaultBatchTimeout     = 5 * time.Second
+)
+
+// BatchConfig 批量接口的配置，为 0 时使用默认值
+type BatchConfig struct {
+	// MaxItems 单次请求最多包含的接口数，默认 20
+	MaxItems int
+	// Concurrency 同时执行的接口数，默认 5
+	Concurrency int
+	// Timeout 整个批量请求的超时时间，超时未完成的接口返回 504，默认 5 秒
+	Timeout time.Duration
+}
+
+func (c BatchConfig) withDefaults() BatchConfig {
+	if c.MaxItems <= 0 {
+		c.MaxItems = defaultBatchMaxItems
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = defaultBatchConcurrency
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultBatchTimeout
+	}
+	return c
+}
+
+// BatchItem 批量请求中的单个接口
+type BatchItem struct {
+	// API 相对于接口前缀的路径，如 user/profile，RESTful 接口可以带路径参数和 query，如 users/1?fields=name
+	API string `json:"api"`
+	// Method 请求方法，默认 POST
+	Method string `json:"method,omitempty"`
+	// Body 请求体，GET、HEAD、DELETE 请求忽略
+	Body stdjson.RawMessage `json:"body,omitempty"`
+}
+
+// BatchResult 单个接口的响应，顺序和请求一致
+type BatchResult struct {
+	Status int                `json:"status"`
+	Body   stdjson.RawMessage `json:"body,omitempty"`
+}
+
+// BatchPath 批量接口的路径，为接口前缀加上 _batch，如 /api/_batch
+func BatchPath() string {
+	prefix := apiPathPrefix
+	if prefix == kAnyApiPathPrefixAllowed {
+		prefix = "/"
+	}
+	return prefix + batchKey
+}
+
+// BatchHandler 批量接口，请求体为 BatchItem 的数组。
+//
+// 每个接口使用原请求的 header 构造新的请求交给 handler（通常是 gin.Engine）处理，
+// 和单独调用一样经过参数绑定、PreHandler 和限流，并各自记录访问日志，ReqId 和原请求相同。
+// 原请求的 Idempotency-Key 加上序号作为子请求的幂等键，如 key:0、key:1。
+// 签名包含请求体，需要签名校验的接口不能批量调用
+func BatchHandler(handler http.Handler, config BatchConfig) gin.HandlerFunc {
+	config = config.withDefaults()
+
+	return func(c *gin.Context) {
+		if !checkBodySize(c, batchKey, globalMaxBodySize()) {
+			return
+		}
+		var items []BatchItem
+		err := c.ShouldBindJSON(&items)
+		if errors.Is(err, errBodyTooLarge) {
+			rejectBodyTooLarge(c, batchKey, "body")
+			return
+		}
+		if err != nil {
+			failHandler(c, http.StatusBadRequest, ErrInvalidParam, err.Error())
+			return
+		}
+		if len(items) == 0 {
+			failHandler(c, http.StatusBadRequest, ErrInvalidParam, "批量请求不能为空")
+			return
+		}
+		if len(items) > config.MaxItems {
+			failHandler(c, http.StatusBadRequest, ErrInvalidParam, fmt.Sprintf("批量请求最多包含%d个接口", config.MaxItems))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), config.Timeout)
+		defer cancel()
+
+		reqId, level, _ := getReqInfo(c)
+		results := runBatch(ctx, handler, c.Request, items, config.Concurrency, reqId, level)
+		c.PureJSON(http.StatusOK, Resp{Code: ErrOK, Data: results})
+	}
+}
+
+// runBatch 并发执行批量请求，ctx 结束时未完成的接口返回超时
+func runBatch(ctx context.Context, handler http.Handler, parent *http.Request, items []BatchItem, concurrency int, reqId string, level int) []*BatchResult {
+	results := make([]*BatchResult, len(items))
+	writers := make([]*batchResponseWriter, len(items))
+	done := make([]chan struct{}, len(items))
+	sem := make(chan struct{}, concurrency)
+
+	for i, item := range items {
+		done[i] = make(chan struct{})
+		req, err := newBatchRequest(ctx, parent, i, item, reqId, level)
+		if err != nil {
+			results[i] = batchErrorResult(http.StatusBadRequest, ErrInvalidParam, err.Error())
+			close(done[i])
+			continue
+		}
+
+		writers[i] = newBatchResponseWriter()
+		go func(i int) {
+			defer close(done[i])
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+			handler.ServeHTTP(writers[i], req)
+			// 超时后才返回的响应是 ctx 取消导致的，按超时处理
+			writers[i].expired = ctx.Err() != nil
+		}(i)
+	}
+
+	for i := range items {
+		select {
+		case <-done[i]:
+		case <-ctx.Done():
+			// 超时后不再读取还在执行的接口，避免和写入并发
+			select {
+			case <-done[i]:
+			default:
+				results[i] = batchErrorResult(http.StatusGatewayTimeout, ErrRequestTimeout, "请求处理超时")
+				continue
+			}
+		}
+		if results[i] == nil {
+			results[i] = writers[i].result()
+		}
+	}
+	return results
+}
+
+// newBatchRequest 使用原请求的 header 构造子请求，幂等键加上子请求的序号，避免子请求之间冲突
+func newBatchRequest(ctx context.Context, parent *http.Request, index int, item BatchItem, reqId string, level int) (*http.Request, error) {
+	api := strings.TrimPrefix(item.API, "/")
+	if api == "" || strings.HasPrefix(api, batchKey) {
+		return nil, fmt.Errorf("invalid api: %q", item.API)
+	}
+	method := strings.ToUpper(item.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	prefix := apiPathPrefix
+	if prefix == kAnyApiPathPrefixAllowed {
+		prefix = "/"
+	}
+
+	var body []byte
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+	default:
+		body = item.Body
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, prefix+api, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = parent.Header.Clone()
+	req.Header.Del("Content-Length")
+	// 子请求的响应需要嵌入到 json 中，不能压缩
+	req.Header.Del("Accept-Encoding")
+	req.Header.Del("Content-Encoding")
+	req.Header.Set("Content-Type", binding.MIMEJSON)
+	if key := parent.Header.Get(IdempotencyKeyHeader); key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key+":"+strconv.Itoa(index))
+	}
+	// 子请求的 Span 是批量请求的子 Span
+	tracing.InjectHTTP(ctx, req.Header)
+	if reqId != "" {
+		req.Header.Set(perf.ReqIdKey, reqId)
+		req.Header.Set(perf.ReqLevel, strconv.Itoa(level))
+	}
+	req.Host = parent.Host
+	req.RemoteAddr = parent.RemoteAddr
+	return req, nil
+}
+
+func batchErrorResult(status, code int, message string) *BatchResult {
+	body, _ := json.Marshal(&Resp{Code: code, Message: message})
+	return &BatchResult{Status: status, Body: body}
+}
+
+// batchResponseWriter 保存子请求的响应
+type batchResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	// expired 子请求在批量请求超时后才结束
+	expired bool
+}
+
+func newBatchResponseWriter() *batchResponseWriter {
+	return &batchResponseWriter{header: http.Header{}}
+}
+
+func (w *batchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *batchResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+// Flush 流式响应会调用，数据在子请求结束后一起返回
+func (w *batchResponseWriter) Flush() {}
+
+// result json 响应原样返回，其他响应作为字符串返回
+func (w *batchResponseWriter) result() *BatchResult {
+	if w.status == 0 || w.expired {
+		return batchErrorResult(http.StatusGatewayTimeout, ErrRequestTimeout, "请求处理超时")
+	}
+
+	body := bytes.TrimSpace(w.body.Bytes())
+	if len(body) > 0 && !stdjson.Valid(body) {
+		body, _ = json.Marshal(string(body))
+	}
+	return &BatchResult{Status: w.status, Body: body}
+}
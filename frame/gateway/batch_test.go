@@ -0,0 +1,126 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xbonlinenet/goup/frame/perf"
+)
+
+func TestBatchHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var running, maxRunning int32
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(perf.ReqIdKey, "req-1")
+		c.Set(perf.ReqLevel, 1)
+	})
+	r.POST("/api/demo/echo", func(c *gin.Context) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		var body map[string]interface{}
+		_ = c.ShouldBindJSON(&body)
+		c.JSON(http.StatusOK, gin.H{"body": body, "reqId": c.GetHeader(perf.ReqIdKey), "token": c.GetHeader("Authorization"), "idempotencyKey": c.GetHeader(IdempotencyKeyHeader)})
+	})
+	r.GET("/api/users/:id", func(c *gin.Context) {
+		c.String(http.StatusNotFound, "user %s not found", c.Param("id"))
+	})
+	r.POST("/api/demo/slow", func(c *gin.Context) {
+		select {
+		case <-time.After(time.Second):
+		case <-c.Request.Context().Done():
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	})
+	r.POST("/api/_batch", BatchHandler(r, BatchConfig{Concurrency: 2, Timeout: 200 * time.Millisecond}))
+
+	body := `[
+		{"api": "demo/echo", "body": {"n": 1}},
+		{"api": "demo/echo", "body": {"n": 2}},
+		{"api": "demo/echo", "body": {"n": 3}},
+		{"api": "users/7", "method": "GET"},
+		{"api": "_batch"},
+		{"api": "demo/slow"}
+	]`
+	req := httptest.NewRequest(http.MethodPost, "/api/_batch", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer t")
+	req.Header.Set(IdempotencyKeyHeader, "k")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var raw struct {
+		Data []BatchResult `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if len(raw.Data) != 6 {
+		t.Fatalf("expected 6 results, got %d: %s", len(raw.Data), w.Body.String())
+	}
+
+	for i := 0; i < 3; i++ {
+		var echo struct {
+			Body           map[string]int `json:"body"`
+			ReqId          string         `json:"reqId"`
+			Token          string         `json:"token"`
+			IdempotencyKey string         `json:"idempotencyKey"`
+		}
+		if err := json.Unmarshal(raw.Data[i].Body, &echo); err != nil {
+			t.Fatal(err)
+		}
+		if raw.Data[i].Status != http.StatusOK || echo.Body["n"] != i+1 {
+			t.Fatalf("result %d should be in order, got %s", i, raw.Data[i].Body)
+		}
+		if echo.ReqId != "req-1" || echo.Token != "Bearer t" {
+			t.Fatalf("sub request should share reqId and headers, got %+v", echo)
+		}
+		if echo.IdempotencyKey != "k:"+strconv.Itoa(i) {
+			t.Fatalf("sub request should have its own idempotency key, got %s", echo.IdempotencyKey)
+		}
+	}
+
+	if raw.Data[3].Status != http.StatusNotFound || string(raw.Data[3].Body) != `"user 7 not found"` {
+		t.Fatalf("unexpected result: %d %s", raw.Data[3].Status, raw.Data[3].Body)
+	}
+	if raw.Data[4].Status != http.StatusBadRequest {
+		t.Fatalf("nested batch should be rejected, got %d", raw.Data[4].Status)
+	}
+	if raw.Data[5].Status != http.StatusGatewayTimeout {
+		t.Fatalf("slow api should time out, got %d", raw.Data[5].Status)
+	}
+
+	if n := atomic.LoadInt32(&maxRunning); n > 2 {
+		t.Fatalf("concurrency should be limited to 2, got %d", n)
+	}
+}
+
+func TestRunBatchCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	parent := httptest.NewRequest(http.MethodPost, "/api/_batch", nil)
+	results := runBatch(ctx, handler, parent, []BatchItem{{API: "demo/echo"}}, 1, "", 0)
+	if results[0].Status != http.StatusGatewayTimeout {
+		t.Fatalf("expected timeout, got %d", results[0].Status)
+	}
+}
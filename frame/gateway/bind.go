@@ -0,0 +1,148 @@
+package gateway
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// 请求参数的来源
+const (
+	sourceBody   = "body"
+	sourceQuery  = "query"
+	sourcePath   = "path"
+	sourceHeader = "header"
+	sourceCookie = "cookie"
+	sourceFile   = "file"
+)
+
+// requestSources 请求结构体中除 body 以外的参数来源，注册接口时解析
+type requestSources struct {
+	// queries json 接口中只有 form tag 的字段，从 query 参数中绑定
+	queries []string
+	// files 存在上传文件的字段
+	files   bool
+	headers []string
+	cookies []string
+}
+
+func newRequestSources(reqType reflect.Type) *requestSources {
+	sources := &requestSources{}
+	walkFields(reqType, func(field reflect.StructField) {
+		switch fieldSource(field) {
+		case sourceHeader:
+			sources.headers = append(sources.headers, tagName(field, "header"))
+		case sourceCookie:
+			sources.cookies = append(sources.cookies, tagName(field, "cookie"))
+		case sourceQuery:
+			sources.queries = append(sources.queries, tagName(field, "form"))
+		case sourceFile:
+			sources.files = true
+		}
+	})
+	return sources
+}
+
+// fieldSource 字段的来源，json 接口中只有 form tag 的字段从 query 中读取
+func fieldSource(field reflect.StructField) string {
+	if isFileType(field.Type) {
+		return sourceFile
+	}
+	for _, source := range []string{sourcePath, sourceHeader, sourceCookie} {
+		if name := tagName(field, source); name != "" && name != "-" {
+			return source
+		}
+	}
+	if tagName(field, "json") == "" && tagName(field, "form") != "" {
+		return sourceQuery
+	}
+	return sourceBody
+}
+
+func tagName(field reflect.StructField, tag string) string {
+	return strings.Split(field.Tag.Get(tag), ",")[0]
+}
+
+// bindRequest 依次从 path、header、cookie、query 和 body 中绑定请求参数，绑定 body 时统一校验。
+// 返回出错时字段名使用的 tag
+func bindRequest(c *gin.Context, info *HandlerInfo, request interface{}, pathParams gin.Params) (string, error) {
+	if err := bindPathParams(request, pathParams); err != nil {
+		return sourcePath, err
+	}
+
+	sources := info.sources
+	if sources == nil {
+		sources = &requestSources{}
+	}
+
+	if len(sources.headers) > 0 {
+		values := make(map[string][]string, len(sources.headers))
+		for _, name := range sources.headers {
+			if v := c.Request.Header.Values(name); len(v) > 0 {
+				values[name] = v
+			}
+		}
+		if err := binding.MapFormWithTag(request, values, "header"); err != nil {
+			return sourceHeader, err
+		}
+	}
+
+	if len(sources.cookies) > 0 {
+		values := make(map[string][]string, len(sources.cookies))
+		for _, name := range sources.cookies {
+			if v, err := c.Cookie(name); err == nil {
+				values[name] = []string{v}
+			}
+		}
+		if err := binding.MapFormWithTag(request, values, "cookie"); err != nil {
+			return sourceCookie, err
+		}
+	}
+
+	if info.pt == formType {
+		return "form", c.ShouldBindQuery(request)
+	}
+
+	if len(sources.queries) > 0 {
+		// 只绑定声明的 query 参数，没有 form tag 的字段会使用字段名匹配，不能从 query 中覆盖 body 的字段
+		query := c.Request.URL.Query()
+		values := make(map[string][]string, len(sources.queries))
+		for _, name := range sources.queries {
+			if v, ok := query[name]; ok {
+				values[name] = v
+			}
+		}
+		if err := binding.MapFormWithTag(request, values, "form"); err != nil {
+			return "form", err
+		}
+	}
+
+	switch c.ContentType() {
+	case binding.MIMEPOSTForm:
+		return "form", c.ShouldBindWith(request, binding.FormPost)
+	case binding.MIMEMultipartPOSTForm:
+		// 超过 maxMemory 的文件会写入临时目录，请求结束后由 net/http 删除
+		if err := c.Request.ParseMultipartForm(info.upload.maxMemory()); err != nil {
+			return "form", err
+		}
+		return "form", c.ShouldBindWith(request, binding.FormMultipart)
+	}
+
+	var body []byte
+	if c.Request.Body != nil {
+		var err error
+		if body, err = getBody(c); err != nil {
+			return "json", err
+		}
+	}
+	switch normalizeMIME(c.ContentType()) {
+	case MIMEMsgpack:
+		return "msgpack", bindMsgpack(body, request)
+	case MIMEProtobuf:
+		// 生成的 protobuf 结构体带有 json tag
+		return "json", bindProtobuf(body, request)
+	}
+	return "json", c.ShouldBindBodyWith(request, binding.JSON)
+}
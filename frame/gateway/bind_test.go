@@ -0,0 +1,148 @@
+package gateway
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type bindTestRequest struct {
+	ID      int64  `path:"id" json:"-"`
+	Token   string `header:"X-Token" json:"-" binding:"required"`
+	Session string `cookie:"session" json:"-"`
+	Page    int    `form:"page"`
+	Message string `json:"message" form:"message" binding:"required"`
+}
+
+func TestBindRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	multipartBody := &bytes.Buffer{}
+	writer := multipart.NewWriter(multipartBody)
+	writer.WriteField("message", "hello")
+	writer.Close()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		token       string
+		want        bindTestRequest
+		wantField   string
+	}{
+		{
+			name:        "json body",
+			contentType: "application/json",
+			body:        `{"message": "hello"}`,
+			token:       "t",
+			want:        bindTestRequest{ID: 12, Token: "t", Session: "s", Page: 2, Message: "hello"},
+		},
+		{
+			name:        "urlencoded body",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "message=hello",
+			token:       "t",
+			want:        bindTestRequest{ID: 12, Token: "t", Session: "s", Page: 2, Message: "hello"},
+		},
+		{
+			name:        "multipart body",
+			contentType: writer.FormDataContentType(),
+			body:        multipartBody.String(),
+			token:       "t",
+			want:        bindTestRequest{ID: 12, Token: "t", Session: "s", Page: 2, Message: "hello"},
+		},
+		{
+			name:        "missing header",
+			contentType: "application/json",
+			body:        `{"message": "hello"}`,
+			wantField:   "X-Token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &HandlerInfo{
+				reqType: reflect.TypeOf(bindTestRequest{}),
+				sources: newRequestSources(reflect.TypeOf(bindTestRequest{})),
+			}
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request, _ = http.NewRequest(http.MethodPost, "/api/users/12?page=2", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", tt.contentType)
+			if tt.token != "" {
+				c.Request.Header.Set("X-Token", tt.token)
+			}
+			c.Request.AddCookie(&http.Cookie{Name: "session", Value: "s"})
+
+			var req bindTestRequest
+			tag, err := bindRequest(c, info, &req, gin.Params{{Key: "id", Value: "12"}})
+			if tt.wantField != "" {
+				fields := bindingFieldErrors(c, info.reqType, tag, err)
+				if len(fields) != 1 || fields[0].Field != tt.wantField {
+					t.Errorf("field errors = %v, %v", fields, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if req != tt.want {
+				t.Errorf("bindRequest() = %+v, want %+v", req, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldSource(t *testing.T) {
+	info := getDTOFieldInfo(reflect.TypeOf(bindTestRequest{}), false)
+
+	want := map[string]string{
+		"id":      sourcePath,
+		"X-Token": sourceHeader,
+		"session": sourceCookie,
+		"page":    sourceQuery,
+		"message": sourceBody,
+	}
+	for _, f := range info.fields {
+		if want[f.name] != f.source {
+			t.Errorf("%s: source = %s, want %s", f.name, f.source, want[f.name])
+		}
+	}
+}
+
+func TestBindJSONIgnoresUndeclaredQuery(t *testing.T) {
+	type request struct {
+		UserID  int64  `json:"-"`
+		Page    int    `form:"page"`
+		Message string `json:"message" binding:"required"`
+	}
+	info := &HandlerInfo{
+		reqType: reflect.TypeOf(request{}),
+		sources: newRequestSources(reflect.TypeOf(request{})),
+	}
+	newContext := func(body string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequest(http.MethodPost, "/api/users?page=2&UserID=1&Message=query", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		return c
+	}
+
+	// 只有 form tag 的字段从 query 中读取，其他字段不能通过 query 设置
+	var req request
+	if _, err := bindRequest(newContext(`{"message": "hello"}`), info, &req, nil); err != nil {
+		t.Fatal(err)
+	}
+	if req != (request{Page: 2, Message: "hello"}) {
+		t.Errorf("bindRequest() = %+v", req)
+	}
+
+	// json 接口的 body 为空时和之前一样返回参数错误
+	if _, err := bindRequest(newContext(""), info, &request{}, nil); err == nil {
+		t.Error("empty json body should return error")
+	}
+}
@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+)
+
+// maxBodySizeKey 全局的请求体最大字节数，没有配置或者为 0 时不限制
+const maxBodySizeKey = "gateway.max_body_size"
+
+var errRequestTooLarge = NewError(ErrRequestTooLarge, "请求体过大").WithStatus(http.StatusRequestEntityTooLarge)
+
+// bodyTooLargeCounter 统计请求体过大被拒绝的请求，reason 为 content_length、body、decompressed
+var bodyTooLargeCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "request_body_too_large",
+	Help: "rejected request by body size",
+}, []string{"api", "reason"})
+
+// MaxBodySize 设置接口请求体的最大字节数，覆盖全局的 gateway.max_body_size，小于 0 时不限制
+func MaxBodySize(n int64) Option {
+	return optionFunc(func(handler *HandlerInfo) {
+		handler.maxBodySize = n
+	})
+}
+
+// maxBodySize 接口请求体的最大字节数，优先使用 MaxBodySize，其次是 Upload 的 MaxRequestSize，
+// 最后是全局配置 gateway.max_body_size（默认为 0，不限制）
+func maxBodySize(info *HandlerInfo) int64 {
+	if info.maxBodySize != 0 {
+		return info.maxBodySize
+	}
+	if info.upload != nil && info.upload.MaxRequestSize > 0 {
+		return info.upload.MaxRequestSize
+	}
+	return globalMaxBodySize()
+}
+
+func globalMaxBodySize() int64 {
+	return viper.GetInt64(maxBodySizeKey)
+}
+
+// checkBodySize Content-Length 超过限制时直接拒绝，否则限制读取的字节数，返回 false 时已经写入响应
+func checkBodySize(c *gin.Context, apiKey string, limit int64) bool {
+	if limit <= 0 {
+		return true
+	}
+	if c.Request.ContentLength > limit {
+		rejectBodyTooLarge(c, apiKey, "content_length")
+		return false
+	}
+	limitRequestBody(c, limit)
+	return true
+}
+
+// rejectBodyTooLarge 返回 413，并且不再保持连接，剩余的请求体不需要继续读取
+func rejectBodyTooLarge(c *gin.Context, apiKey, reason string) {
+	bodyTooLargeCounter.WithLabelValues(apiKey, reason).Inc()
+	c.Header("Connection", "close")
+	failHandler(c, errRequestTooLarge.HTTPStatus(), errRequestTooLarge.Code(), errRequestTooLarge.Message())
+}
@@ -0,0 +1,54 @@
+package gateway
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func TestMaxBodySize(t *testing.T) {
+	defer viper.Set(maxBodySizeKey, nil)
+
+	tests := []struct {
+		name   string
+		info   *HandlerInfo
+		global interface{}
+		want   int64
+	}{
+		{"default unlimited", &HandlerInfo{}, nil, 0},
+		{"global", &HandlerInfo{}, 1024, 1024},
+		{"global unlimited", &HandlerInfo{}, 0, 0},
+		{"upload", &HandlerInfo{upload: &UploadLimit{MaxRequestSize: 2048}}, 1024, 2048},
+		{"api", &HandlerInfo{maxBodySize: 512, upload: &UploadLimit{MaxRequestSize: 2048}}, 1024, 512},
+		{"api unlimited", &HandlerInfo{maxBodySize: -1}, 1024, -1},
+	}
+	for _, tt := range tests {
+		viper.Set(maxBodySizeKey, tt.global)
+		if got := maxBodySize(tt.info); got != tt.want {
+			t.Errorf("%s: maxBodySize() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckBodySize(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/test", strings.NewReader(strings.Repeat("x", 100)))
+	// 分块传输时没有 Content-Length，读取时才能判断
+	c.Request.ContentLength = -1
+
+	if !checkBodySize(c, "test", 10) {
+		t.Fatal("request without content length should be read")
+	}
+	if _, err := io.ReadAll(c.Request.Body); !errors.Is(err, errBodyTooLarge) {
+		t.Fatalf("err = %v, want errBodyTooLarge", err)
+	}
+	if _, err := getBody(c); !errors.Is(err, errBodyTooLarge) {
+		t.Fatalf("getBody err = %v, want errBodyTooLarge", err)
+	}
+}
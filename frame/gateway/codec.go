@@ -0,0 +1,152 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/vmihailenco/msgpack"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/xbonlinenet/goup/frame/log"
+)
+
+// 除 json 外支持的请求和响应格式
+const (
+	MIMEProtobuf = "application/x-protobuf"
+	MIMEMsgpack  = "application/msgpack"
+)
+
+var errProtobufNotSupported = NewError(ErrInvalidParam, "接口不支持 protobuf 格式的请求").WithStatus(http.StatusUnsupportedMediaType)
+
+// acceptItem Accept、Accept-Encoding 中的一项
+type acceptItem struct {
+	value string
+	q     float64
+}
+
+// parseAccept 解析 Accept 形式的请求头，q 为 0 的项也会返回
+func parseAccept(header string) []acceptItem {
+	var items []acceptItem
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		value := strings.ToLower(strings.TrimSpace(fields[0]))
+		if value == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		items = append(items, acceptItem{value: value, q: q})
+	}
+	return items
+}
+
+// normalizeMIME 统一 msgpack 和 protobuf 的各种写法，其他类型原样返回
+func normalizeMIME(mimeType string) string {
+	switch mimeType {
+	case MIMEMsgpack, binding.MIMEMSGPACK:
+		return MIMEMsgpack
+	case MIMEProtobuf, "application/protobuf", "application/vnd.google.protobuf":
+		return MIMEProtobuf
+	}
+	return mimeType
+}
+
+// negotiateFormat 根据 Accept 选择响应的格式，没有明确要求 msgpack 或 protobuf 时返回 json
+func negotiateFormat(accept string) string {
+	items := parseAccept(accept)
+	// q 相同时具体的类型优先于通配符
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].q != items[j].q {
+			return items[i].q > items[j].q
+		}
+		return !strings.Contains(items[i].value, "*") && strings.Contains(items[j].value, "*")
+	})
+	for _, item := range items {
+		if item.q <= 0 {
+			continue
+		}
+		switch format := normalizeMIME(item.value); format {
+		case MIMEMsgpack, MIMEProtobuf:
+			return format
+		case binding.MIMEJSON, "*/*", "application/*":
+			return binding.MIMEJSON
+		}
+	}
+	return binding.MIMEJSON
+}
+
+// bindMsgpack 使用 msgpack tag 绑定请求，没有 msgpack tag 时使用 json tag
+func bindMsgpack(body []byte, request interface{}) error {
+	if err := msgpack.NewDecoder(bytes.NewReader(body)).UseJSONTag(true).Decode(request); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(request)
+}
+
+// bindProtobuf 请求参数需要实现 proto.Message
+func bindProtobuf(body []byte, request interface{}) error {
+	m, ok := request.(proto.Message)
+	if !ok {
+		return errProtobufNotSupported
+	}
+	if err := proto.Unmarshal(body, m); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(request)
+}
+
+func marshalMsgpack(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := msgpack.NewEncoder(&buf).UseJSONTag(true).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeResponse 根据 Accept 返回 json、msgpack 或者 protobuf。
+// 只有实现 proto.Message 的响应才能返回 protobuf，无法使用协商的格式时返回 406；
+// isErr 为 true 时是 Handler 返回的错误，无法使用协商的格式时返回 json
+func writeResponse(c *gin.Context, status int, response interface{}, isErr bool) {
+	c.Writer.Header().Add("Vary", "Accept")
+
+	switch format := negotiateFormat(c.GetHeader("Accept")); format {
+	case MIMEMsgpack:
+		b, err := marshalMsgpack(response)
+		if err == nil {
+			c.Data(status, MIMEMsgpack, b)
+			return
+		}
+		log.Default().Warn("marshal msgpack response error", zap.String("path", c.Request.URL.Path), zap.Error(err))
+		if !isErr {
+			failHandler(c, http.StatusNotAcceptable, ErrInvalidParam, "响应无法使用 "+format+" 格式")
+			return
+		}
+	case MIMEProtobuf:
+		if m, ok := response.(proto.Message); ok {
+			b, err := proto.Marshal(m)
+			if err == nil {
+				c.Data(status, MIMEProtobuf, b)
+				return
+			}
+			log.Default().Warn("marshal protobuf response error", zap.String("path", c.Request.URL.Path), zap.Error(err))
+		}
+		if !isErr {
+			failHandler(c, http.StatusNotAcceptable, ErrInvalidParam, "响应无法使用 "+format+" 格式")
+			return
+		}
+	}
+	c.PureJSON(status, response) // 默认是json，但是如果返回的是二进制的json串，此方法会编码成base64格式
+}
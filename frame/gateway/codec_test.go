@@ -0,0 +1,141 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/vmihailenco/msgpack"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	cases := []struct {
+		accept string
+		expect string
+	}{
+		{"", binding.MIMEJSON},
+		{"*/*", binding.MIMEJSON},
+		{"application/json", binding.MIMEJSON},
+		{"application/msgpack", MIMEMsgpack},
+		{"application/x-msgpack", MIMEMsgpack},
+		{"application/x-protobuf", MIMEProtobuf},
+		{"application/msgpack, */*", MIMEMsgpack},
+		{"application/json;q=0.5, application/msgpack", MIMEMsgpack},
+		{"application/msgpack;q=0.5, application/json", binding.MIMEJSON},
+		{"text/html", binding.MIMEJSON},
+	}
+	for _, tc := range cases {
+		if got := negotiateFormat(tc.accept); got != tc.expect {
+			t.Errorf("negotiateFormat(%q) = %q, expect %q", tc.accept, got, tc.expect)
+		}
+	}
+}
+
+type codecTestRequest struct {
+	Name string `json:"name" binding:"required"`
+	Age  int    `msgpack:"age_years"`
+}
+
+func TestBindMsgpack(t *testing.T) {
+	body, _ := msgpack.Marshal(map[string]interface{}{"name": "goup", "age_years": 3})
+	var req codecTestRequest
+	if err := bindMsgpack(body, &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Name != "goup" || req.Age != 3 {
+		t.Fatalf("unexpected request %+v", req)
+	}
+
+	// 绑定后校验参数
+	body, _ = msgpack.Marshal(map[string]interface{}{"age_years": 3})
+	if err := bindMsgpack(body, &codecTestRequest{}); err == nil {
+		t.Fatal("expected validation error")
+	}
+}
+
+func TestBindProtobuf(t *testing.T) {
+	body, _ := proto.Marshal(wrapperspb.String("goup"))
+	req := &wrapperspb.StringValue{}
+	if err := bindProtobuf(body, req); err != nil || req.Value != "goup" {
+		t.Fatalf("unexpected request %v %v", req, err)
+	}
+
+	if err := bindProtobuf(body, &codecTestRequest{}); err != errProtobufNotSupported {
+		t.Fatalf("expected protobuf not supported, got %v", err)
+	}
+}
+
+func TestWriteResponse(t *testing.T) {
+	newTestAPIEngine() // 406 的响应会写入网关的日志
+	write := func(accept string, response interface{}, isErr bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/test", nil)
+		c.Request.Header.Set("Accept", accept)
+		writeResponse(c, http.StatusOK, response, isErr)
+		return w
+	}
+
+	w := write(MIMEMsgpack, Resp{Code: ErrOK, Message: "ok"}, false)
+	if w.Header().Get("Content-Type") != MIMEMsgpack {
+		t.Fatalf("unexpected content type %q", w.Header().Get("Content-Type"))
+	}
+	var resp map[string]interface{}
+	if err := msgpack.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp["message"] != "ok" {
+		t.Fatalf("unexpected msgpack response %v %v", resp, err)
+	}
+
+	w = write(MIMEProtobuf, wrapperspb.String("goup"), false)
+	var value wrapperspb.StringValue
+	if w.Header().Get("Content-Type") != MIMEProtobuf || proto.Unmarshal(w.Body.Bytes(), &value) != nil || value.Value != "goup" {
+		t.Fatalf("unexpected protobuf response %q", w.Body.String())
+	}
+
+	// 不是 proto.Message 时返回 406
+	w = write(MIMEProtobuf, Resp{Code: ErrOK, Message: "ok"}, false)
+	if w.Code != http.StatusNotAcceptable || !strings.Contains(w.Body.String(), `"code":1`) {
+		t.Fatalf("unexpected not acceptable response %d %q", w.Code, w.Body.String())
+	}
+
+	// msgpack 编码失败时返回 406
+	w = write(MIMEMsgpack, map[string]interface{}{"ch": make(chan int)}, false)
+	if w.Code != http.StatusNotAcceptable {
+		t.Fatalf("unexpected msgpack error response %d %q", w.Code, w.Body.String())
+	}
+
+	// Handler 返回的错误使用 json
+	w = write(MIMEProtobuf, Resp{Code: ErrLogicError, Message: "failed"}, true)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json; charset=utf-8" || w.Body.String() != "{\"code\":6,\"message\":\"failed\"}\n" {
+		t.Fatalf("unexpected error response %q %q", w.Header().Get("Content-Type"), w.Body.String())
+	}
+	if w.Header().Get("Vary") != "Accept" {
+		t.Fatal("missing vary header")
+	}
+}
+
+func TestProtobufNotSupported(t *testing.T) {
+	Register("codec", "json", "json api", func(c *ApiContext, req *registerRequest) (*registerResponse, error) {
+		return &registerResponse{Message: req.Message}, nil
+	})
+	r := newTestAPIEngine()
+
+	serve := func(contentType string) *httptest.ResponseRecorder {
+		body, _ := proto.Marshal(wrapperspb.String("goup"))
+		req := httptest.NewRequest(http.MethodPost, "/api/codec/json", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 请求参数没有实现 proto.Message
+	if w := serve(MIMEProtobuf); w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("protobuf request = %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,348 @@
+package gateway
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/xbonlinenet/goup/frame/log"
+)
+
+// 压缩的默认配置
+const (
+	defaultCompressMinSize        = 1024
+	defaultMaxDecompressedSize    = 10 << 20
+	encodingGzip                  = "gzip"
+	encodingDeflate               = "deflate"
+	encodingBrotli                = "br"
+	encodingZstd                  = "zstd"
+	encodingIdentity              = "identity"
+	compressionConfigKey          = "gateway.compression"
+	defaultCompressionContentType = "application/json"
+)
+
+var (
+	defaultCompressEncodings = []string{encodingBrotli, encodingZstd, encodingGzip, encodingDeflate}
+	defaultCompressTypes     = []string{defaultCompressionContentType, "application/xml", "application/javascript", "text/*"}
+
+	errUnsupportedEncoding = NewError(ErrInvalidParam, "不支持的 Content-Encoding").WithStatus(http.StatusUnsupportedMediaType)
+)
+
+// CompressionConfig 响应压缩的配置，全局配置在 gateway.compression 下
+type CompressionConfig struct {
+	// Enable 全局配置中开启响应压缩，Compression 设置的接口配置默认开启
+	Enable bool `mapstructure:"enable"`
+	// Disable 关闭接口的响应压缩
+	Disable bool `mapstructure:"disable"`
+	// Encodings 支持的编码，客户端权重相同时按顺序选择，默认 br、zstd、gzip、deflate
+	Encodings []string `mapstructure:"encodings"`
+	// MinSize 响应超过该字节数才压缩，默认 1024
+	MinSize int `mapstructure:"min_size"`
+	// Types 压缩的 Content-Type，支持 text/* 的形式，默认 json、xml、javascript 和 text/*
+	Types []string `mapstructure:"types"`
+	// MaxDecompressedSize 压缩的请求体解压后的最大字节数，默认 10MB
+	MaxDecompressedSize int64 `mapstructure:"max_decompressed_size"`
+}
+
+// Compression 设置接口的响应压缩，覆盖全局配置
+func Compression(config CompressionConfig) Option {
+	config.Enable = !config.Disable
+	return optionFunc(func(handler *HandlerInfo) {
+		handler.compression = &config
+	})
+}
+
+var (
+	globalCompressionOnce sync.Once
+	globalCompression     CompressionConfig
+)
+
+// compressionConfig 接口的压缩配置，接口没有设置时使用全局配置
+func compressionConfig(info *HandlerInfo) *CompressionConfig {
+	if info.compression != nil {
+		return info.compression
+	}
+	globalCompressionOnce.Do(func() {
+		if err := viper.UnmarshalKey(compressionConfigKey, &globalCompression); err != nil {
+			log.Default().Error("invalid compression config", zap.Error(err))
+		}
+	})
+	return &globalCompression
+}
+
+func (cfg *CompressionConfig) encodings() []string {
+	if len(cfg.Encodings) == 0 {
+		return defaultCompressEncodings
+	}
+	return cfg.Encodings
+}
+
+func (cfg *CompressionConfig) minSize() int {
+	if cfg.MinSize <= 0 {
+		return defaultCompressMinSize
+	}
+	return cfg.MinSize
+}
+
+func (cfg *CompressionConfig) maxDecompressedSize() int64 {
+	if cfg.MaxDecompressedSize <= 0 {
+		return defaultMaxDecompressedSize
+	}
+	return cfg.MaxDecompressedSize
+}
+
+func (cfg *CompressionConfig) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	types := cfg.Types
+	if len(types) == 0 {
+		types = defaultCompressTypes
+	}
+	return mimeTypeAllowed(mediaType, types)
+}
+
+// negotiateEncoding 根据 Accept-Encoding 选择编码，没有可用的编码时返回空
+func negotiateEncoding(acceptEncoding string, supported []string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	weights := map[string]float64{}
+	for _, item := range parseAccept(acceptEncoding) {
+		weights[item.value] = item.q
+	}
+
+	candidates := make([]string, 0, len(supported))
+	for _, encoding := range supported {
+		q, ok := weights[encoding]
+		if !ok {
+			q, ok = weights["*"]
+		}
+		if ok && q > 0 {
+			weights[encoding] = q
+			candidates = append(candidates, encoding)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return weights[candidates[i]] > weights[candidates[j]]
+	})
+	return candidates[0]
+}
+
+var compressorPools = map[string]*sync.Pool{
+	encodingGzip: {New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	}},
+	encodingDeflate: {New: func() interface{} {
+		return zlib.NewWriter(io.Discard)
+	}},
+	encodingBrotli: {New: func() interface{} {
+		return brotli.NewWriterLevel(io.Discard, brotli.DefaultCompression)
+	}},
+	encodingZstd: {New: func() interface{} {
+		w, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderLevel(zstd.SpeedDefault))
+		return w
+	}},
+}
+
+// resetWriter gzip、zlib、brotli、zstd 的 Writer 都支持 Reset
+type resetWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// compressWriter 压缩响应，响应达到 MinSize 后才决定是否压缩
+type compressWriter struct {
+	gin.ResponseWriter
+	config   *CompressionConfig
+	encoding string
+
+	buf     []byte
+	decided bool
+	closed  bool
+	enc     resetWriter
+}
+
+// compressResponse 替换 c.Writer 压缩之后写入的响应，返回的 Writer 需要在请求结束时 close
+func compressResponse(c *gin.Context, config *CompressionConfig) *compressWriter {
+	if !config.Enable || config.Disable {
+		return nil
+	}
+	encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"), config.encodings())
+	if encoding == "" || compressorPools[encoding] == nil {
+		return nil
+	}
+
+	w := &compressWriter{ResponseWriter: c.Writer, config: config, encoding: encoding}
+	c.Writer = w
+	return w
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.config.minSize() {
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written 缓存中有数据时也视为已经写入
+func (w *compressWriter) Written() bool {
+	return len(w.buf) > 0 || w.ResponseWriter.Written()
+}
+
+// decide 根据状态码、Content-Type 和大小决定是否压缩，并写入缓存的数据
+func (w *compressWriter) decide() error {
+	w.decided = true
+	header := w.Header()
+
+	status := w.Status()
+	compress := len(w.buf) >= w.config.minSize() &&
+		status != http.StatusNoContent && status != http.StatusNotModified &&
+		header.Get("Content-Encoding") == "" &&
+		w.config.compressible(header.Get("Content-Type"))
+
+	header.Add("Vary", "Accept-Encoding")
+	if compress {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		w.enc = compressorPools[w.encoding].Get().(resetWriter)
+		w.enc.Reset(w.ResponseWriter)
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush 立即写入缓存的数据
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		_ = w.decide()
+	}
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// close 写入剩余的数据，之后的写入不再压缩
+func (w *compressWriter) close() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+
+	if !w.decided && len(w.buf) > 0 {
+		_ = w.decide()
+	}
+	w.decided = true
+
+	if w.enc != nil {
+		_ = w.enc.Close()
+		w.enc.Reset(io.Discard)
+		compressorPools[w.encoding].Put(w.enc)
+		w.enc = nil
+	}
+}
+
+// decompressRequestBody 解压请求体，需要在签名校验之后执行，签名使用压缩后的数据计算
+func decompressRequestBody(c *gin.Context, maxSize int64) error {
+	encoding := strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding")))
+	if encoding == "" || encoding == encodingIdentity || c.Request.Body == nil {
+		return nil
+	}
+
+	raw, err := getBody(c)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader
+	switch encoding {
+	case encodingGzip, "x-gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return errUnsupportedEncoding.Wrap(err)
+		}
+		defer gr.Close()
+		r = gr
+	case encodingDeflate:
+		// 标准的 deflate 是 zlib 格式，也兼容没有 zlib 头的数据
+		if zr, err := zlib.NewReader(bytes.NewReader(raw)); err == nil {
+			defer zr.Close()
+			r = zr
+		} else {
+			fr := flate.NewReader(bytes.NewReader(raw))
+			defer fr.Close()
+			r = fr
+		}
+	case encodingBrotli:
+		r = brotli.NewReader(bytes.NewReader(raw))
+	case encodingZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(raw), zstd.WithDecoderMaxMemory(uint64(maxSize)+1))
+		if err != nil {
+			return errUnsupportedEncoding.Wrap(err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return errUnsupportedEncoding
+	}
+
+	// 多读一个字节判断是否超过限制，防止压缩炸弹
+	body, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return errUnsupportedEncoding.Wrap(err)
+	}
+	if int64(len(body)) > maxSize {
+		return errBodyTooLarge
+	}
+
+	c.Set(gin.BodyBytesKey, body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Request.ContentLength = int64(len(body))
+	c.Request.Header.Del("Content-Encoding")
+	c.Request.Header.Del("Content-Length")
+	return nil
+}
@@ -0,0 +1,173 @@
+package gateway
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/xbonlinenet/goup/frame/cache"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := []struct {
+		accept string
+		expect string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, br", "br"},
+		{"gzip;q=1.0, br;q=0.5", "gzip"},
+		{"br;q=0, gzip", "gzip"},
+		{"*", "br"},
+		{"*;q=0.5, zstd", "zstd"},
+		{"identity", ""},
+		{"GZIP", "gzip"},
+	}
+	for _, tc := range cases {
+		if got := negotiateEncoding(tc.accept, defaultCompressEncodings); got != tc.expect {
+			t.Errorf("negotiateEncoding(%q) = %q, expect %q", tc.accept, got, tc.expect)
+		}
+	}
+}
+
+func TestCompressResponse(t *testing.T) {
+	config := &CompressionConfig{Enable: true, MinSize: 16}
+
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+		compressed  bool
+	}{
+		{"json", "application/json; charset=utf-8", strings.Repeat(`{"a":1}`, 10), true},
+		{"small", "application/json", `{}`, false},
+		{"image", "image/png", strings.Repeat("x", 100), false},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/test", nil)
+		c.Request.Header.Set("Accept-Encoding", "gzip")
+
+		cw := compressResponse(c, config)
+		c.Data(http.StatusOK, tc.contentType, []byte(tc.body))
+		cw.close()
+
+		if got := w.Header().Get("Content-Encoding") == "gzip"; got != tc.compressed {
+			t.Errorf("%s: compressed = %v, expect %v", tc.name, got, tc.compressed)
+			continue
+		}
+		if w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%s: missing vary header", tc.name)
+		}
+		body := w.Body.Bytes()
+		if tc.compressed {
+			r, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ = io.ReadAll(r)
+		}
+		if string(body) != tc.body {
+			t.Errorf("%s: unexpected body %q", tc.name, body)
+		}
+	}
+}
+
+func TestCompressionWithRecordedResponse(t *testing.T) {
+	config := &CompressionConfig{Enable: true}
+	codec := cache.BuildCacheCodec("gateway-compression-test", nil, true, 100, time.Minute)
+	rc := &responseCache{ttl: time.Minute, keyFn: CacheKeyByRequest, codec: func() (*cache.Codec, error) { return codec, nil }}
+	store := newLocalIdempotencyStore()
+	idem := &idempotency{store: store}
+	request := &cacheTestRequest{ID: 1}
+
+	call := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/order/create", bytes.NewBufferString(`{"id":1}`))
+		c.Request.Header.Set("Accept-Encoding", "gzip")
+		c.Request.Header.Set(IdempotencyKeyHeader, "k1")
+		c.Set(gin.BodyBytesKey, []byte(`{"id":1}`))
+		apiContext := &ApiContext{Request: c.Request, AppKey: "app", respHeaders: map[string]string{}}
+
+		// 和 handlerApiRequest 中的顺序相同，压缩最先 defer，在缓存和幂等保存响应之后才 close
+		cw := compressResponse(c, config)
+		defer cw.close()
+		cached, done := rc.begin(c, apiContext, "order.create", request, nil)
+		if done {
+			return w
+		}
+		defer cached.finish(c)
+		idemReq, done := idem.begin(c, apiContext, "order.create")
+		if done {
+			return w
+		}
+		defer idemReq.finish(c)
+
+		setResultCode(c, ErrOK)
+		c.JSON(http.StatusOK, gin.H{"orderId": 1})
+		return w
+	}
+
+	first := call()
+	if record, _ := store.get("order.create:app:k1"); record == nil || string(record.Body) != `{"orderId":1}` {
+		t.Fatalf("idempotent response should be saved with compression, got %+v", record)
+	}
+
+	second := call()
+	if second.Header().Get(responseCacheHeader) != "HIT" {
+		t.Fatal("response should be cached with compression")
+	}
+	if second.Body.String() != first.Body.String() {
+		t.Fatalf("unexpected cached body %q", second.Body.String())
+	}
+}
+
+func TestDecompressRequestBody(t *testing.T) {
+	payload := []byte(`{"name":"goup"}`)
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(payload)
+	gw.Close()
+
+	zw, _ := zstd.NewWriter(nil)
+	zs := zw.EncodeAll(payload, nil)
+	zw.Close()
+
+	newContext := func(encoding string, body []byte) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/test", bytes.NewReader(body))
+		c.Request.Header.Set("Content-Encoding", encoding)
+		return c
+	}
+
+	for encoding, body := range map[string][]byte{"gzip": gz.Bytes(), "zstd": zs} {
+		c := newContext(encoding, body)
+		if err := decompressRequestBody(c, 1024); err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		got, _ := io.ReadAll(c.Request.Body)
+		if !bytes.Equal(got, payload) || c.GetHeader("Content-Encoding") != "" {
+			t.Fatalf("%s: unexpected body %q", encoding, got)
+		}
+	}
+
+	// 解压后超过限制
+	if err := decompressRequestBody(newContext("gzip", gz.Bytes()), 8); err != errBodyTooLarge {
+		t.Fatalf("expected body too large, got %v", err)
+	}
+	// 不支持的编码
+	if err := decompressRequestBody(newContext("compress", payload), 1024); err != errUnsupportedEncoding {
+		t.Fatalf("expected unsupported encoding, got %v", err)
+	}
+}
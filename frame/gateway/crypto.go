@@ -1,24 +1,50 @@
 package gateway
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 )
 
+// errDecryptFailed 解密失败
+var errDecryptFailed = NewError(ErrCryptoError, "数据加密错误").WithStatus(http.StatusBadRequest)
+
 //解密处理器,用于解析request前解密request数据
 type CryptoHandler struct {
+	name        string                                     //加密方式，展示在接口文档中
 	decryptImpl func(c *gin.Context) bool                  //数据解密
 	encryptImpl func(c *gin.Context, d interface{}) string //返回结果加密
+	// decryptErrImpl 内置的加解密返回具体的错误，优先于 decryptImpl
+	decryptErrImpl func(c *gin.Context) *Error
 }
 
 func NewCryptoHandler(encryptImpl func(c *gin.Context, d interface{}) string, decryptImpl func(c *gin.Context) bool) *CryptoHandler {
 	return &CryptoHandler{
+		name:        "custom",
 		decryptImpl: decryptImpl,
 		encryptImpl: encryptImpl,
 	}
 }
+
+// Name 加密方式
+func (crypto *CryptoHandler) Name() string {
+	return crypto.name
+}
 func (crypto *CryptoHandler) Decrypt(c *gin.Context) bool {
-	return crypto.Decrypt(c)
+	return crypto.decryptImpl(c)
 }
+
+// decrypt 解密请求数据，失败时返回给客户端的错误
+func (crypto *CryptoHandler) decrypt(c *gin.Context) *Error {
+	if crypto.decryptErrImpl != nil {
+		return crypto.decryptErrImpl(c)
+	}
+	if crypto.decryptImpl != nil && !crypto.decryptImpl(c) {
+		return errDecryptFailed
+	}
+	return nil
+}
+
 func (crypto *CryptoHandler) Encrypt(c *gin.Context, d interface{}) string {
 	return crypto.encryptImpl(c, d)
 }
@@ -0,0 +1,324 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/xbonlinenet/goup/frame/log"
+)
+
+// AES-GCM 加密使用的请求头
+const (
+	// HeaderCryptoKeyVersion 密钥版本，用于密钥轮换
+	HeaderCryptoKeyVersion = "X-Crypto-Key-Version"
+	// HeaderCryptoEphemeralKey ECDH(X25519) 模式下客户端的临时公钥
+	HeaderCryptoEphemeralKey = "X-Crypto-Ephemeral-Key"
+	// HeaderCryptoSessionKey RSA 模式下使用服务端公钥(OAEP-SHA256)加密后的会话密钥
+	HeaderCryptoSessionKey = "X-Crypto-Session-Key"
+
+	// formCryptoParam FormParam 接口加密后的 query 参数名
+	formCryptoParam = "data"
+
+	cryptoKeyContextKey = "goup-crypto-key"
+)
+
+var errCryptoKeyNotFound = errors.New("crypto key not found")
+
+// errCryptoKeyVersionRequired ECDH/RSA 密钥交换需要指定服务端密钥的版本
+var errCryptoKeyVersionRequired = NewError(ErrInvalidParam, "缺少请求头 "+HeaderCryptoKeyVersion).WithStatus(http.StatusBadRequest)
+
+// CryptoKeyStore 预共享密钥，key 为 16/24/32 字节的 AES 密钥
+type CryptoKeyStore interface {
+	// Key version 为空时返回当前使用的密钥
+	Key(appKey, version string) (key []byte, realVersion string, err error)
+}
+
+// AESGCMConfig AES-GCM 加密配置，ECDH/RSA 密钥交换是可选的
+type AESGCMConfig struct {
+	// Keys 预共享密钥，默认从配置文件 gateway.crypto.apps 中读取
+	Keys CryptoKeyStore
+	// ECDHKeys 各个版本的 X25519 私钥，请求携带 X-Crypto-Ephemeral-Key 时使用
+	ECDHKeys map[string]*ecdh.PrivateKey
+	// RSAKeys 各个版本的 RSA 私钥，请求携带 X-Crypto-Session-Key 时使用
+	RSAKeys map[string]*rsa.PrivateKey
+}
+
+// configCryptoKeyStore 从配置文件中读取预共享密钥
+//
+//	gateway:
+//	  crypto:
+//	    apps:
+//	      - key: demo-app
+//	        current: v2
+//	        keys:
+//	          v1: base64 编码的密钥
+//	          v2: base64 编码的密钥
+type configCryptoKeyStore struct {
+	once sync.Once
+	apps map[string]*cryptoApp
+	err  error
+}
+
+type cryptoApp struct {
+	AppKey  string            `mapstructure:"key"`
+	Current string            `mapstructure:"current"`
+	Keys    map[string]string `mapstructure:"keys"`
+}
+
+// NewConfigCryptoKeyStore 从配置文件中读取预共享密钥
+func NewConfigCryptoKeyStore() CryptoKeyStore {
+	return &configCryptoKeyStore{}
+}
+
+func (s *configCryptoKeyStore) Key(appKey, version string) ([]byte, string, error) {
+	s.once.Do(func() {
+		var apps []*cryptoApp
+		s.err = viper.UnmarshalKey("gateway.crypto.apps", &apps)
+		s.apps = make(map[string]*cryptoApp, len(apps))
+		for _, app := range apps {
+			s.apps[app.AppKey] = app
+		}
+	})
+	if s.err != nil {
+		return nil, "", s.err
+	}
+
+	app, ok := s.apps[appKey]
+	if !ok {
+		return nil, "", errCryptoKeyNotFound
+	}
+	if version == "" {
+		version = app.Current
+	}
+	encoded, ok := app.Keys[strings.ToLower(version)]
+	if !ok {
+		return nil, "", errCryptoKeyNotFound
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	return key, version, err
+}
+
+// aesGCMCrypto 内置的 AES-GCM 加解密
+type aesGCMCrypto struct {
+	config AESGCMConfig
+}
+
+// cryptoKey 单次请求使用的密钥
+type cryptoKey struct {
+	key     []byte
+	version string
+}
+
+// NewAESGCMCryptoHandler 创建内置的 AES-GCM 加解密处理器
+//
+// 请求体 (FormParam 接口为 query 参数 data) 为 base64(nonce|密文)，解密后再进行参数绑定；
+// 正常的响应使用同一个密钥加密后以 json 字符串返回。密钥根据 X-App-Key 和 X-Crypto-Key-Version 选择，
+// 也可以通过 ECDH/RSA 密钥交换得到一次性的会话密钥。
+func NewAESGCMCryptoHandler(config AESGCMConfig) *CryptoHandler {
+	if config.Keys == nil {
+		config.Keys = NewConfigCryptoKeyStore()
+	}
+	crypto := &aesGCMCrypto{config: config}
+
+	return &CryptoHandler{
+		name: "AES-GCM",
+		decryptImpl: func(c *gin.Context) bool {
+			return crypto.decrypt(c) == nil
+		},
+		encryptImpl:    crypto.encrypt,
+		decryptErrImpl: crypto.decrypt,
+	}
+}
+
+// resolveKey 根据请求头选择密钥
+func (a *aesGCMCrypto) resolveKey(c *gin.Context) (*cryptoKey, error) {
+	version := c.GetHeader(HeaderCryptoKeyVersion)
+
+	if pub := c.GetHeader(HeaderCryptoEphemeralKey); pub != "" {
+		if version == "" {
+			return nil, errCryptoKeyVersionRequired
+		}
+		priv, ok := a.config.ECDHKeys[version]
+		if !ok {
+			return nil, errCryptoKeyNotFound
+		}
+		raw, err := base64.StdEncoding.DecodeString(pub)
+		if err != nil {
+			return nil, err
+		}
+		peer, err := priv.Curve().NewPublicKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		shared, err := priv.ECDH(peer)
+		if err != nil {
+			return nil, err
+		}
+		return &cryptoKey{key: deriveKey(shared), version: version}, nil
+	}
+
+	if sessionKey := c.GetHeader(HeaderCryptoSessionKey); sessionKey != "" {
+		if version == "" {
+			return nil, errCryptoKeyVersionRequired
+		}
+		priv, ok := a.config.RSAKeys[version]
+		if !ok {
+			return nil, errCryptoKeyNotFound
+		}
+		raw, err := base64.StdEncoding.DecodeString(sessionKey)
+		if err != nil {
+			return nil, err
+		}
+		key, err := rsa.DecryptOAEP(sha256.New(), nil, priv, raw, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &cryptoKey{key: key, version: version}, nil
+	}
+
+	key, realVersion, err := a.config.Keys.Key(c.GetHeader(HeaderAppKey), version)
+	if err != nil {
+		return nil, err
+	}
+	return &cryptoKey{key: key, version: realVersion}, nil
+}
+
+// deriveKey HKDF-SHA256，从 ECDH 的共享密钥中导出 32 字节的 AES 密钥
+func deriveKey(shared []byte) []byte {
+	extract := hmac.New(sha256.New, make([]byte, sha256.Size))
+	extract.Write(shared)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write([]byte("goup-aes-gcm"))
+	expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
+
+// decrypt 解密请求数据。签名在解密之前已经使用密文校验，参数绑定使用解密后的内容
+func (a *aesGCMCrypto) decrypt(c *gin.Context) *Error {
+	key, err := a.resolveKey(c)
+	if err != nil {
+		log.Default().Warn("resolve crypto key error", zap.String("path", c.Request.URL.Path), zap.Error(err))
+		var e *Error
+		if errors.As(err, &e) {
+			return e
+		}
+		return errDecryptFailed
+	}
+	c.Set(cryptoKeyContextKey, key)
+
+	var body []byte
+	if c.Request.Body != nil {
+		if body, err = getBody(c); err != nil {
+			return errDecryptFailed
+		}
+	}
+	body = bytes.TrimSpace(body)
+
+	if len(body) == 0 {
+		// FormParam 接口，加密内容在 query 参数中，解密后是原始的 query
+		payload := c.Query(formCryptoParam)
+		if payload == "" {
+			return nil
+		}
+		plain, err := aesGCMOpen(key.key, payload)
+		if err != nil {
+			log.Default().Warn("decrypt query error", zap.String("path", c.Request.URL.Path), zap.Error(err))
+			return errDecryptFailed
+		}
+		c.Request.URL.RawQuery = string(plain)
+		return nil
+	}
+
+	plain, err := aesGCMOpen(key.key, string(body))
+	if err != nil {
+		log.Default().Warn("decrypt body error", zap.String("path", c.Request.URL.Path), zap.Error(err))
+		return errDecryptFailed
+	}
+
+	// 后续的参数绑定使用解密后的内容
+	c.Set(gin.BodyBytesKey, plain)
+	c.Request.Body = io.NopCloser(bytes.NewReader(plain))
+	return nil
+}
+
+func (a *aesGCMCrypto) encrypt(c *gin.Context, d interface{}) string {
+	v, ok := c.Get(cryptoKeyContextKey)
+	if !ok {
+		panic("crypto key not resolved")
+	}
+	key := v.(*cryptoKey)
+
+	plain, err := json.Marshal(d)
+	if err != nil {
+		panic(err)
+	}
+
+	cipherText, err := aesGCMSeal(key.key, plain)
+	if err != nil {
+		panic(err)
+	}
+
+	if key.version != "" {
+		c.Header(HeaderCryptoKeyVersion, key.version)
+	}
+	return cipherText
+}
+
+// aesGCMSeal 返回 base64(nonce|密文)
+func aesGCMSeal(key, plain []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, nil)), nil
+}
+
+// aesGCMOpen 解密 base64(nonce|密文)
+func aesGCMOpen(key []byte, payload string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < gcm.NonceSize() {
+		return nil, fmt.Errorf("cipher text too short: %d", len(raw))
+	}
+	return gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,112 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+type staticCryptoKeyStore map[string][]byte
+
+func (s staticCryptoKeyStore) Key(appKey, version string) ([]byte, string, error) {
+	if version == "" {
+		version = "v1"
+	}
+	key, ok := s[appKey+":"+version]
+	if !ok {
+		return nil, "", errCryptoKeyNotFound
+	}
+	return key, version, nil
+}
+
+func TestAESGCMCryptoHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	key := bytes.Repeat([]byte{1}, 32)
+	handler := NewAESGCMCryptoHandler(AESGCMConfig{
+		Keys: staticCryptoKeyStore{"app:v1": key},
+	})
+
+	payload, _ := aesGCMSeal(key, []byte(`{"message":"hello"}`))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/api/demo/echo", bytes.NewBufferString(payload))
+	c.Request.Header.Set(HeaderAppKey, "app")
+
+	if !handler.Decrypt(c) {
+		t.Fatalf("decrypt failed")
+	}
+
+	var req struct {
+		Message string `json:"message"`
+	}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil || req.Message != "hello" {
+		t.Fatalf("bind decrypted body failed: %v, %+v", err, req)
+	}
+
+	encrypted := handler.Encrypt(c, map[string]string{"message": "world"})
+	plain, err := aesGCMOpen(key, encrypted)
+	if err != nil || string(plain) != `{"message":"world"}` {
+		t.Fatalf("encrypt response failed: %v, %s", err, plain)
+	}
+	if w.Header().Get(HeaderCryptoKeyVersion) != "v1" {
+		t.Errorf("key version header not set")
+	}
+}
+
+func TestAESGCMCryptoHandlerECDH(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	serverKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	clientKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+
+	handler := NewAESGCMCryptoHandler(AESGCMConfig{
+		Keys:     staticCryptoKeyStore{},
+		ECDHKeys: map[string]*ecdh.PrivateKey{"v2": serverKey},
+	})
+
+	shared, _ := clientKey.ECDH(serverKey.PublicKey())
+	payload, _ := aesGCMSeal(deriveKey(shared), []byte("page=1&size=10"))
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest(http.MethodGet, "/api/demo/list?data="+url.QueryEscape(payload), nil)
+	c.Request.Header.Set(HeaderCryptoKeyVersion, "v2")
+	c.Request.Header.Set(HeaderCryptoEphemeralKey, base64.StdEncoding.EncodeToString(clientKey.PublicKey().Bytes()))
+
+	if !handler.Decrypt(c) {
+		t.Fatalf("decrypt failed")
+	}
+	if c.Request.URL.RawQuery != "page=1&size=10" {
+		t.Errorf("query = %s", c.Request.URL.RawQuery)
+	}
+}
+
+func TestAESGCMCryptoHandlerKeyVersionRequired(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	serverKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	clientKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+
+	handler := NewAESGCMCryptoHandler(AESGCMConfig{
+		Keys:     staticCryptoKeyStore{},
+		ECDHKeys: map[string]*ecdh.PrivateKey{"": serverKey, "v2": serverKey},
+	})
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest(http.MethodGet, "/api/demo/list", nil)
+	c.Request.Header.Set(HeaderCryptoEphemeralKey, base64.StdEncoding.EncodeToString(clientKey.PublicKey().Bytes()))
+
+	e := handler.decrypt(c)
+	if e == nil || e.Code() != ErrInvalidParam || e.HTTPStatus() != http.StatusBadRequest {
+		t.Fatalf("decrypt without key version = %v", e)
+	}
+}
@@ -3,12 +3,16 @@ package gateway
 import (
 	"fmt"
 	"github.com/xbonlinenet/goup/frame/log"
+	"github.com/xbonlinenet/goup/frame/tracing"
 	"go.uber.org/zap"
 )
 
 // buildTrace 。。。
 func (c *ApiContext) buildTrace() []zap.Field {
 	trace := log.GetLogFields("reqId", c.ReqId, "reqLevel", c.ReqLevel)
+	if traceId := tracing.TraceID(c); traceId != "" {
+		trace = append(trace, zap.String("traceId", traceId))
+	}
 	return trace
 }
 
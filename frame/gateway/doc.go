@@ -40,6 +40,11 @@ func ApiList(c *gin.Context) {
 					<thead><tr><th>Group</th><th>API</th><th>Description</th></tr><thead>
 					<tbody>%s</tbody>
 					</table>
+					<h3>Error Codes</h3>
+					<table class="pure-table pure-table-bordered">
+					<thead><tr><th>Code</th><th>Message</th></tr><thead>
+					<tbody>%s</tbody>
+					</table>
 				</div>
 
 
@@ -84,17 +89,30 @@ func ApiList(c *gin.Context) {
 			if len(defaultUrl) == 0 {
 				defaultUrl = "./detail?name=" + api.Group + "." + api.Key
 			}
+			name := api.Name
+			if api.Method != "" {
+				name = fmt.Sprintf("%s <code>%s %s</code>", name, api.Method, api.Path)
+			}
+			if info, ok := apiHandlerFuncMap[api.Group+"."+api.Key]; ok && info.cryptoHandler != nil {
+				name += " 🔒"
+			}
 			if i == 0 {
-				sb.WriteString(fmt.Sprintf(apiGroupTemplate, len(g.Apis), api.Group, api.Group+"."+api.Key, url.QueryEscape(api.Key), api.Name))
+				sb.WriteString(fmt.Sprintf(apiGroupTemplate, len(g.Apis), api.Group, api.Group+"."+api.Key, url.QueryEscape(api.Key), name))
 
 			} else {
-				sb.WriteString(fmt.Sprintf(apiTemplate, api.Group+"."+api.Key, url.QueryEscape(api.Key), api.Name))
+				sb.WriteString(fmt.Sprintf(apiTemplate, api.Group+"."+api.Key, url.QueryEscape(api.Key), name))
 			}
 
 		}
 	}
 
-	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(fmt.Sprintf(html, head, sb.String(), defaultUrl)))
+	errorCodeTemplate := `<tr><td>%d</td><td>%s</td></tr>`
+	codes := strings.Builder{}
+	for _, code := range ErrorCodes() {
+		codes.WriteString(fmt.Sprintf(errorCodeTemplate, code.Code, code.Message))
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(fmt.Sprintf(html, head, sb.String(), codes.String(), defaultUrl)))
 
 }
 
@@ -144,15 +162,22 @@ func ApiDetail(c *gin.Context) {
 	</html>
 	`
 
+	x := apiHandlerFuncMap[name]
+
 	request := strings.Builder{}
 	request.WriteString(`
 	<table class="pure-table pure-table-bordered">
-	<thead><tr><th>FieldName</th><th>Type</th><th>Required</th><th>Description</th></tr></thead>
+	<thead><tr><th>FieldName</th><th>In</th><th>Type</th><th>Required</th><th>Description</th></tr></thead>
 	<tbody>
 	`)
 	fieldTemplate := `<tr><td>%s</td><td>%s</td><td>%t</td><td>%s</td></tr>`
+	requestFieldTemplate := `<tr><td>%s</td><td>%s</td><td>%s</td><td>%t</td><td>%s</td></tr>`
 	for _, f := range api.Request.fields {
-		request.WriteString(fmt.Sprintf(fieldTemplate, f.name, f.typ, f.required, f.desc))
+		source := f.source
+		if x.pt == formType && source == sourceBody {
+			source = sourceQuery
+		}
+		request.WriteString(fmt.Sprintf(requestFieldTemplate, f.name, source, f.typ, f.required, f.desc))
 	}
 	request.WriteString("</tbody></table>")
 
@@ -212,8 +237,6 @@ func ApiDetail(c *gin.Context) {
 		schema = "https"
 	}
 
-	path := fmt.Sprintf("%s://%s/api/%s/%s", schema, c.Request.Host, api.Group, strings.ReplaceAll(api.Key, ".", "/"))
-
 	req := reflect.New(api.ReqType).Interface()
 	err := faker.FakeData(&req)
 	var body []byte
@@ -226,18 +249,37 @@ func ApiDetail(c *gin.Context) {
 	}
 	util.CheckError(err)
 
+	path := fmt.Sprintf("%s://%s%s", schema, c.Request.Host, getAPIPath(api, req))
+	method := http.MethodPost
+	if x.route != nil {
+		method = x.route.method
+	}
+
 	var mock string
-	x := apiHandlerFuncMap[name]
-	if x.pt == formType {
-		mock = ""
+	if x.sources != nil && x.sources.files {
+		mock = fmt.Sprintf(`<pre class="code">curl -X %s -H "Accept: application/json" \
+	'%s' \%s
+	-H "Mock: true"</pre>`, method, path, multipartCurlFields(api.ReqType))
+	} else if x.pt == formType {
+		if x.route != nil {
+			mock = fmt.Sprintf(`<pre class="code">curl -X %s -H "Accept: application/json" \
+	'%s' \
+	-H "Mock: true"</pre>`, method, path)
+		}
 	} else {
-		mock = fmt.Sprintf(`<pre class="code">curl -X POST -H "Accept: application/json" -H "Content-Type: application/json" \
+		mock = fmt.Sprintf(`<pre class="code">curl -X %s -H "Accept: application/json" -H "Content-Type: application/json" \
 	'%s' \
 	-d'%s' \
-	-H "Mock: true"</pre>`, path, string(body))
+	-H "Mock: true"</pre>`, method, path, string(body))
 	}
 
 	extInfo := ""
+	if x.route != nil {
+		extInfo += fmt.Sprintf("<p><b> Route: </b><span> %s %s </span></p>", x.route.method, x.route.path)
+	}
+	if x.cryptoHandler != nil {
+		extInfo += fmt.Sprintf("<p><b> Encrypted: </b><span> %s </span></p>", x.cryptoHandler.Name())
+	}
 	for k, v := range x.extInfo {
 		extInfo += "<p>"
 		extInfo += fmt.Sprintf("<b> %s: </b>", k)
@@ -251,3 +293,28 @@ func ApiDetail(c *gin.Context) {
 	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(data))
 
 }
+
+// multipartCurlFields 上传文件接口 curl 的 -F 参数
+func multipartCurlFields(reqType reflect.Type) string {
+	sb := strings.Builder{}
+	walkFields(reqType, func(field reflect.StructField) {
+		source := fieldSource(field)
+		if source != sourceBody && source != sourceQuery && source != sourceFile {
+			return
+		}
+		name := tagName(field, "form")
+		if name == "-" {
+			return
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		if source == sourceFile {
+			sb.WriteString(fmt.Sprintf("\n\t-F '%s=@/path/to/file' \\", name))
+		} else {
+			sb.WriteString(fmt.Sprintf("\n\t-F '%s=' \\", name))
+		}
+	})
+	return sb.String()
+}
@@ -0,0 +1,187 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// CodeError 带业务错误码的错误，Handler 返回该类错误时使用自定义的 code 和 HTTP 状态码
+type CodeError interface {
+	error
+	Code() int
+	HTTPStatus() int
+}
+
+// Error 业务错误, 返回给客户端的只有 message 和 data，cause 只用于日志
+type Error struct {
+	code    int
+	status  int
+	message string
+	data    interface{}
+	cause   error
+}
+
+// NewError 创建业务错误
+func NewError(code int, message string) *Error {
+	return &Error{code: code, message: message}
+}
+
+// Error 包含原始错误，用于日志
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%s: %s", e.message, e.cause.Error())
+	}
+	return e.message
+}
+
+// Code 业务错误码
+func (e *Error) Code() int {
+	return e.code
+}
+
+// HTTPStatus 响应的 HTTP 状态码，默认 200
+func (e *Error) HTTPStatus() int {
+	if e.status == 0 {
+		return http.StatusOK
+	}
+	return e.status
+}
+
+// Message 返回给客户端的错误信息
+func (e *Error) Message() string {
+	return e.message
+}
+
+// Data 返回给客户端的附加数据
+func (e *Error) Data() interface{} {
+	return e.data
+}
+
+// Unwrap 支持 errors.Is/errors.As 查找原始错误
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is 错误码相同即认为是同一种错误
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.code == e.code
+}
+
+// WithStatus 返回设置了 HTTP 状态码的副本
+func (e *Error) WithStatus(status int) *Error {
+	n := *e
+	n.status = status
+	return &n
+}
+
+// WithMessage 返回设置了错误信息的副本
+func (e *Error) WithMessage(message string) *Error {
+	n := *e
+	n.message = message
+	return &n
+}
+
+// WithData 返回携带附加数据的副本
+func (e *Error) WithData(data interface{}) *Error {
+	n := *e
+	n.data = data
+	return &n
+}
+
+// Wrap 返回包装了原始错误的副本
+func (e *Error) Wrap(cause error) *Error {
+	n := *e
+	n.cause = cause
+	return &n
+}
+
+// errorResp 将 Handler 返回的错误转换为响应，支持 fmt.Errorf("%w") 包装的错误
+func errorResp(err error) (int, Resp) {
+	var codeErr CodeError
+	if !errors.As(err, &codeErr) {
+		return http.StatusOK, Resp{Code: ErrLogicError, Message: err.Error()}
+	}
+
+	resp := Resp{Code: codeErr.Code(), Message: codeErr.Error()}
+	var m interface{ Message() string }
+	if errors.As(err, &m) {
+		resp.Message = m.Message()
+	}
+	var d interface{ Data() interface{} }
+	if errors.As(err, &d) {
+		resp.Data = d.Data()
+	}
+
+	status := codeErr.HTTPStatus()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return status, resp
+}
+
+// ErrorCode 错误码说明，会展示在接口文档中
+type ErrorCode struct {
+	Code    int    `json:"code" yaml:"code"`
+	Message string `json:"message" yaml:"message"`
+}
+
+var (
+	errorCodes   = map[int]*ErrorCode{}
+	errorCodesMu sync.Mutex
+)
+
+func init() {
+	registerErrorCode(ErrOK, "正确")
+	registerErrorCode(ErrInvalidParam, "请求参数错误")
+	registerErrorCode(ErrExpiredRequest, "请求已经过期")
+	registerErrorCode(ErrInvalidAppKey, "非法的appkey")
+	registerErrorCode(ErrInvalidSignature, "错误的签名")
+	registerErrorCode(ErrAppNotAuthed, "App 未授权调用该接口")
+	registerErrorCode(ErrLogicError, "业务逻辑错误")
+	registerErrorCode(ErrUnknowError, "未知服务错误")
+	registerErrorCode(ErrCryptoError, "数据加密异常")
+	registerErrorCode(ErrRequestTimeout, "请求处理超时")
+	registerErrorCode(ErrTooManyRequests, "请求过于频繁")
+	registerErrorCode(ErrUnauthorized, "未登录或登录已失效")
+	registerErrorCode(ErrMethodNotAllowed, "请求方法不支持")
+	registerErrorCode(ErrIdempotencyKeyReused, "幂等键已用于不同的请求")
+	registerErrorCode(ErrIdempotencyInProgress, "相同的请求正在处理")
+	registerErrorCode(ErrRequestTooLarge, "请求体过大")
+}
+
+func registerErrorCode(code int, message string) {
+	errorCodesMu.Lock()
+	defer errorCodesMu.Unlock()
+
+	if _, ok := errorCodes[code]; ok {
+		panic(fmt.Errorf("error code %d already defined", code))
+	}
+	errorCodes[code] = &ErrorCode{Code: code, Message: message}
+}
+
+// DefineError 定义服务的业务错误码，错误码不能重复
+//
+//	var ErrUserNotFound = gateway.DefineError(1001, "用户不存在")
+func DefineError(code int, message string) *Error {
+	registerErrorCode(code, message)
+	return NewError(code, message)
+}
+
+// ErrorCodes 已定义的错误码，按 code 排序
+func ErrorCodes() []*ErrorCode {
+	errorCodesMu.Lock()
+	defer errorCodesMu.Unlock()
+
+	codes := make([]*ErrorCode, 0, len(errorCodes))
+	for _, c := range errorCodes {
+		codes = append(codes, c)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		return codes[i].Code < codes[j].Code
+	})
+	return codes
+}
@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+var errQuotaExceeded = DefineError(10001, "quota exceeded")
+
+func TestErrorResp(t *testing.T) {
+	cause := errors.New("redis: connection refused")
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantResp   Resp
+	}{
+		{
+			name:       "plain error",
+			err:        errors.New("something wrong"),
+			wantStatus: http.StatusOK,
+			wantResp:   Resp{Code: ErrLogicError, Message: "something wrong"},
+		},
+		{
+			name:       "defined error",
+			err:        errQuotaExceeded,
+			wantStatus: http.StatusOK,
+			wantResp:   Resp{Code: 10001, Message: "quota exceeded"},
+		},
+		{
+			name:       "wrapped cause is hidden",
+			err:        errQuotaExceeded.Wrap(cause).WithStatus(http.StatusTooManyRequests).WithData(map[string]int{"limit": 10}),
+			wantStatus: http.StatusTooManyRequests,
+			wantResp:   Resp{Code: 10001, Message: "quota exceeded", Data: map[string]int{"limit": 10}},
+		},
+		{
+			name:       "wrapped by fmt.Errorf",
+			err:        fmt.Errorf("create order: %w", errQuotaExceeded.WithStatus(http.StatusTooManyRequests)),
+			wantStatus: http.StatusTooManyRequests,
+			wantResp:   Resp{Code: 10001, Message: "quota exceeded"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := errorResp(tt.err)
+			if status != tt.wantStatus {
+				t.Errorf("errorResp() status = %v, want %v", status, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(resp, tt.wantResp) {
+				t.Errorf("errorResp() resp = %v, want %v", resp, tt.wantResp)
+			}
+		})
+	}
+
+	wrapped := errQuotaExceeded.Wrap(cause)
+	if !errors.Is(wrapped, errQuotaExceeded) || !errors.Is(wrapped, cause) {
+		t.Errorf("wrapped error should match both the defined error and the cause")
+	}
+	if wrapped.Error() != "quota exceeded: redis: connection refused" {
+		t.Errorf("Error() = %s", wrapped.Error())
+	}
+}
@@ -1,6 +1,7 @@
 package gateway
 
 import (
+	"context"
 	"net/http"
 	"reflect"
 	"sync"
@@ -36,11 +37,36 @@ const (
 
 	// ErrCryptoError 数据加密异常
 	ErrCryptoError = 8
+
+	// ErrRequestTimeout 请求处理超时
+	ErrRequestTimeout = 9
+
+	// ErrTooManyRequests 请求过于频繁，被限流
+	ErrTooManyRequests = 10
+
+	// ErrUnauthorized 未登录或者登录凭证无效
+	ErrUnauthorized = 11
+
+	// ErrMethodNotAllowed 请求方法不支持
+	ErrMethodNotAllowed = 12
+
+	// ErrIdempotencyKeyReused 幂等键已经用于参数不同的请求
+	ErrIdempotencyKeyReused = 13
+
+	// ErrIdempotencyInProgress 相同幂等键的请求正在处理
+	ErrIdempotencyInProgress = 14
+
+	// ErrRequestTooLarge 请求体超过限制
+	ErrRequestTooLarge = 15
 )
 
 type Resp struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+
+	// status PreHandler 返回时使用的 HTTP 状态码，默认 200
+	status int
 }
 
 type ApiContext struct {
@@ -70,6 +96,19 @@ type ApiContext struct {
 	// response headers
 	respHeaders map[string]string `json:"-"`
 	m           sync.Mutex
+
+	// ctx 请求的 context，客户端断开或者接口超时后会被取消
+	ctx context.Context
+
+	// JWT 鉴权通过后的信息
+	claims Claims
+	userID string
+
+	// RESTful 接口的路径参数
+	pathParams gin.Params
+
+	// ws WebSocket 接口的连接
+	ws *WSConn
 }
 
 func (c *ApiContext) WriteHeader(key, val string) {
@@ -105,17 +144,30 @@ const (
 	TextHtmlType
 	OctetStreamType
 	JsonStreamType
+	// SSEType Server-Sent Events，Handler 返回 channel 或者 StreamIterator
+	SSEType
+	// NDJSONType 每行一个 json，Handler 返回 channel 或者 StreamIterator
+	NDJSONType
 )
 
 type HandlerInfo struct {
 	reqType reflect.Type
 	// reqParaMap map[string]Pair
-	handler reflect.Type
+	// newRequest 创建请求参数，返回结构体指针
+	newRequest func() interface{}
+	// call 调用业务 Handler，request 为 newRequest 创建的参数
+	call func(apiContext *ApiContext, request interface{}) (interface{}, error)
+	// mock 请求头 Mock: true 时返回的数据
+	mock func(request interface{}) interface{}
 	// 接口签名验证时间的有效时间长度
 	expire time.Duration
+	// 接口处理的超时时间，0 表示不限制
+	timeout time.Duration
 
 	pt       paramType
 	respType respType
+	// sources 请求参数中 header、cookie 等来源的字段
+	sources *requestSources
 	// 加解密处理
 	cryptoHandler *CryptoHandler
 	//签名校验处理
@@ -127,6 +179,36 @@ type HandlerInfo struct {
 	// CORS 处理器
 	corsHandler *CORSHandler
 
+	// 限流
+	rateLimiter *RateLimiter
+
+	// route RESTful 接口的请求方法和路径，为空时使用 /group/key 路径
+	route *restRoute
+
+	// upload 文件上传限制
+	upload *UploadLimit
+
+	// heartbeat 流式响应的心跳间隔
+	heartbeat time.Duration
+
+	// websocket 不为空时是 WebSocket 接口，握手请求校验通过后升级连接
+	websocket WebSocketHandler
+	wsConfig  *WebSocketConfig
+
+	// idempotency 接口幂等
+	idempotency *idempotency
+
+	// compression 响应压缩，为空时使用全局配置
+	compression *CompressionConfig
+
+	// maxBodySize 请求体的最大字节数，为 0 时使用全局配置
+	maxBodySize int64
+
+	// 响应缓存和缓存标签
+	cache     *responseCache
+	cacheTags CacheTagFunc
+	evictTags CacheTagFunc
+
 	// extInfo 扩展属性
 	extInfo map[string]string
 }
@@ -137,16 +219,22 @@ type FieldInfo struct {
 	typ      string
 	required bool
 	note     string
+	// source 请求参数的来源: body、query、path、header、cookie
+	source string
 }
 
 // API 接口信息
 type API struct {
-	LineNum  int
-	Key      string
-	Name     string
-	Summary  string
-	Group    string
+	LineNum int
+	Key     string
+	Name    string
+	Summary string
+	Group   string
+	// Method、Path RESTful 接口的请求方法和路径模板，其他接口为空
+	Method   string
+	Path     string
 	ReqType  reflect.Type
+	RespType reflect.Type
 	Request  *DTOInfo
 	Response *DTOInfo
 }
@@ -163,24 +251,36 @@ type DTOInfo struct {
 
 // ============== 以下方法实现golang的标准context接口 ============
 
+func (c *ApiContext) parent() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
 // Deadline  ...
-func (*ApiContext) Deadline() (deadline time.Time, ok bool) {
-	return
+func (c *ApiContext) Deadline() (deadline time.Time, ok bool) {
+	return c.parent().Deadline()
 }
 
 // Done 。。。
-func (*ApiContext) Done() <-chan struct{} {
-	return nil
+func (c *ApiContext) Done() <-chan struct{} {
+	return c.parent().Done()
 }
 
 // Err ...
-func (*ApiContext) Err() error {
-	return nil
+func (c *ApiContext) Err() error {
+	return c.parent().Err()
 }
 
-// Value ...
-func (*ApiContext) Value(key interface{}) interface{} {
-	return nil
+// Value 优先从 Keys 中查找，找不到再从请求的 context 中查找
+func (c *ApiContext) Value(key interface{}) interface{} {
+	if k, ok := key.(string); ok {
+		if v := c.GetKV(k); v != nil {
+			return v
+		}
+	}
+	return c.parent().Value(key)
 }
 
 // =======================================================
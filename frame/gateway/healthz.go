@@ -1,11 +1,33 @@
 package gateway
 
 import (
-	"github.com/gin-gonic/gin"
 	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/xbonlinenet/goup/frame/health"
 )
 
 func HttpHealthz(c *gin.Context) {
 	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte("I'm running now"))
 
-}
\ No newline at end of file
+}
+
+// HttpLiveness 存活检查，只执行注册时使用 health.Liveness 的检查项
+func HttpLiveness(c *gin.Context) {
+	writeHealthReport(c, health.Live(c.Request.Context()))
+}
+
+// HttpReadiness 就绪检查，执行所有的检查项，服务开始关闭后返回 503
+func HttpReadiness(c *gin.Context) {
+	writeHealthReport(c, health.Ready(c.Request.Context()))
+}
+
+func writeHealthReport(c *gin.Context, report *health.Report) {
+	status := http.StatusOK
+	if !report.Up() {
+		status = http.StatusServiceUnavailable
+	}
+	c.Header("Cache-Control", "no-store")
+	c.PureJSON(status, report)
+}
@@ -0,0 +1,378 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	uuid "github.com/satori/go.uuid"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/xbonlinenet/goup/frame/data"
+	"github.com/xbonlinenet/goup/frame/log"
+	"github.com/xbonlinenet/goup/frame/util"
+)
+
+const (
+	// IdempotencyKeyHeader 客户端传递幂等键的请求头
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader 重放的响应中带上该响应头
+	idempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLen = 255
+	// defaultIdempotentLock 处理中的锁的有效期，处理期间每隔 1/3 的有效期续期一次，进程退出后锁最多保留这么长时间
+	defaultIdempotentLock = 30 * time.Second
+)
+
+var (
+	errIdempotencyKeyReused  = NewError(ErrIdempotencyKeyReused, "幂等键已用于不同的请求").WithStatus(http.StatusUnprocessableEntity)
+	errIdempotencyInProgress = NewError(ErrIdempotencyInProgress, "相同的请求正在处理").WithStatus(http.StatusConflict)
+	errIdempotencyUnknown    = NewError(ErrIdempotencyInProgress, "相同的请求处理超时，处理结果未知").WithStatus(http.StatusConflict)
+)
+
+// idempotentRecord 保存的响应，hash 用于判断重试的请求参数是否相同
+type idempotentRecord struct {
+	Hash string `json:"hash"`
+	// Unknown 请求处理超时，Handler 可能还在执行，没有保存响应
+	Unknown bool `json:"unknown,omitempty"`
+	recordedResponse
+}
+
+type idempotencyStore interface {
+	get(key string) (*idempotentRecord, error)
+	save(key string, record *idempotentRecord, ttl time.Duration) error
+	lock(key, owner string, ttl time.Duration) (bool, error)
+	refresh(key, owner string, ttl time.Duration) (bool, error)
+	unlock(key, owner string) error
+}
+
+type idempotency struct {
+	ttl     time.Duration
+	lockTTL time.Duration
+	store   idempotencyStore
+}
+
+// Idempotent 接口幂等，请求头中带有 Idempotency-Key 时，第一次的响应保存 ttl 时间，重试时直接返回保存的响应。
+//
+// 幂等键的作用域为接口和调用方（JWT 的用户或者 AppKey），需要在鉴权的 PreHandler 之后才能确定调用方，
+// 没有调用方的请求不做幂等处理。
+// 相同幂等键的请求正在处理时返回 409，幂等键用于参数不同的请求时返回 422。5xx 的响应不保存，可以重试；
+// 超过 Timeout 的请求 Handler 可能还在执行，结果未知，ttl 时间内的重试都返回 409。
+// 响应保存在 Redis 中，使用 gateway.idempotency.redis 配置的实例，默认为 default
+func Idempotent(ttl time.Duration) Option {
+	return optionFunc(func(handler *HandlerInfo) {
+		handler.idempotency = &idempotency{ttl: ttl, lockTTL: defaultIdempotentLock, store: &redisIdempotencyStore{}}
+	})
+}
+
+// idempotentRequest 正在处理的幂等请求，处理期间定期续期锁，处理完成后保存响应并释放锁
+type idempotentRequest struct {
+	idempotency *idempotency
+	key         string
+	hash        string
+	owner       string
+	writer      *responseRecorder
+	apiContext  *ApiContext
+	stopRefresh chan struct{}
+	// refreshDone 续期结束，释放锁之前等待，避免释放之后还在续期
+	refreshDone chan struct{}
+}
+
+// begin 开始处理幂等请求，返回 true 时已经写入响应（重放或者错误），不需要继续处理
+func (i *idempotency) begin(c *gin.Context, apiContext *ApiContext, apiKey string) (*idempotentRequest, bool) {
+	idempotencyKey := c.GetHeader(IdempotencyKeyHeader)
+	if idempotencyKey == "" {
+		return nil, false
+	}
+	if len(idempotencyKey) > maxIdempotencyKeyLen {
+		failHandler(c, http.StatusBadRequest, ErrInvalidParam, fmt.Sprintf("%s 长度不能超过%d", IdempotencyKeyHeader, maxIdempotencyKeyLen))
+		return nil, true
+	}
+
+	caller := apiContext.UserID()
+	if caller == "" {
+		caller = apiContext.AppKey
+	}
+	if caller == "" {
+		// 没有调用方时不同的客户端会共享幂等键，可能拿到其他客户端的响应，按普通请求处理
+		log.Default().Debug("idempotency skipped without caller", zap.String("api", apiKey))
+		return nil, false
+	}
+	key := fmt.Sprintf("%s:%s:%s", apiKey, caller, idempotencyKey)
+
+	body, _ := c.Get(gin.BodyBytesKey)
+	hash := idempotentHash(c.Request, body)
+
+	// 存储异常时不做幂等处理，避免影响业务
+	if done, err := i.replay(c, key, hash); err != nil {
+		log.Default().Warn("idempotency error", zap.String("api", apiKey), zap.Error(err))
+		return nil, false
+	} else if done {
+		return nil, true
+	}
+
+	lockTTL := i.lockTTL
+	if lockTTL <= 0 {
+		lockTTL = defaultIdempotentLock
+	}
+	// 批量请求中的子请求 ReqId 相同，锁的持有者使用单独的 id
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, false
+	}
+	owner := id.String()
+	ok, err := i.store.lock(key, owner, lockTTL)
+	if err != nil {
+		log.Default().Warn("idempotency lock error", zap.String("api", apiKey), zap.Error(err))
+		return nil, false
+	}
+	if !ok {
+		c.Header("Retry-After", "1")
+		failHandler(c, errIdempotencyInProgress.HTTPStatus(), errIdempotencyInProgress.Code(), errIdempotencyInProgress.Message())
+		return nil, true
+	}
+
+	// 获取锁之前，其他请求可能已经处理完成
+	if done, err := i.replay(c, key, hash); err == nil && done {
+		_ = i.store.unlock(key, owner)
+		return nil, true
+	}
+
+	writer := recordResponse(c)
+	r := &idempotentRequest{
+		idempotency: i,
+		key:         key,
+		hash:        hash,
+		owner:       owner,
+		writer:      writer,
+		apiContext:  apiContext,
+		stopRefresh: make(chan struct{}),
+		refreshDone: make(chan struct{}),
+	}
+	go r.refreshLock(lockTTL)
+	return r, false
+}
+
+// refreshLock Handler 的执行时间可能超过锁的有效期，处理完成之前定期续期
+func (r *idempotentRequest) refreshLock(lockTTL time.Duration) {
+	defer close(r.refreshDone)
+	ticker := time.NewTicker(lockTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stopRefresh:
+			return
+		case <-ticker.C:
+			ok, err := r.idempotency.store.refresh(r.key, r.owner, lockTTL)
+			if err != nil {
+				log.Default().Warn("idempotency refresh lock error", zap.String("key", r.key), zap.Error(err))
+				continue
+			}
+			if !ok {
+				log.Default().Warn("idempotency lock lost", zap.String("key", r.key))
+				return
+			}
+		}
+	}
+}
+
+// replay 存在保存的响应时直接返回，幂等键用于参数不同的请求时返回错误
+func (i *idempotency) replay(c *gin.Context, key, hash string) (bool, error) {
+	record, idemErr, err := i.lookup(key, hash)
+	if err != nil {
+		return false, err
+	}
+	if idemErr != nil {
+		failHandler(c, idemErr.HTTPStatus(), idemErr.Code(), idemErr.Message())
+		return true, nil
+	}
+	if record == nil {
+		return false, nil
+	}
+
+	c.Header(idempotentReplayedHeader, "true")
+	record.writeTo(c)
+	return true, nil
+}
+
+// lookup 查找保存的响应
+func (i *idempotency) lookup(key, hash string) (*idempotentRecord, *Error, error) {
+	record, err := i.store.get(key)
+	if err != nil || record == nil {
+		return nil, nil, err
+	}
+	if record.Hash != hash {
+		return nil, errIdempotencyKeyReused, nil
+	}
+	if record.Unknown {
+		return nil, errIdempotencyUnknown, nil
+	}
+	return record, nil, nil
+}
+
+// finish 保存响应并释放锁，没有写入响应（panic）和 5xx 的响应不保存
+func (r *idempotentRequest) finish(c *gin.Context) {
+	close(r.stopRefresh)
+	<-r.refreshDone
+	defer func() {
+		if err := r.idempotency.store.unlock(r.key, r.owner); err != nil {
+			log.Default().Warn("idempotency unlock error", zap.String("key", r.key), zap.Error(err))
+		}
+	}()
+
+	response := r.writer.response(r.apiContext)
+	if response != nil && response.Status == http.StatusGatewayTimeout && r.apiContext.Err() == context.DeadlineExceeded {
+		// 超时后 Handler 不会被中止，可能还会执行完成，重试时不能再次执行
+		record := &idempotentRecord{Hash: r.hash, Unknown: true}
+		if err := r.idempotency.store.save(r.key, record, r.idempotency.ttl); err != nil {
+			log.Default().Warn("idempotency save error", zap.String("key", r.key), zap.Error(err))
+		}
+		return
+	}
+	if response == nil || response.Status >= http.StatusInternalServerError {
+		return
+	}
+
+	record := &idempotentRecord{Hash: r.hash, recordedResponse: *response}
+	if err := r.idempotency.store.save(r.key, record, r.idempotency.ttl); err != nil {
+		log.Default().Warn("idempotency save error", zap.String("key", r.key), zap.Error(err))
+	}
+}
+
+// idempotentHash 请求路径、query 和 body 的 hash
+func idempotentHash(req *http.Request, body interface{}) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.Path + "?" + req.URL.RawQuery + "\n"))
+	if b, ok := body.([]byte); ok {
+		h.Write(b)
+	} else if req.PostForm != nil {
+		h.Write([]byte(req.PostForm.Encode()))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// redisIdempotencyStore 响应保存在 Redis 中，处理中的请求使用 util.DLock 加锁
+type redisIdempotencyStore struct{}
+
+func (s *redisIdempotencyStore) client() (redis.Cmdable, error) {
+	name := viper.GetString("gateway.idempotency.redis")
+	if name == "" {
+		name = "default"
+	}
+	return data.GetRedis(name)
+}
+
+func (s *redisIdempotencyStore) get(key string) (*idempotentRecord, error) {
+	client, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+	value, err := client.Get("goup:idempotency:" + key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	record := &idempotentRecord{}
+	if err := json.Unmarshal(value, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (s *redisIdempotencyStore) save(key string, record *idempotentRecord, ttl time.Duration) error {
+	client, err := s.client()
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return client.Set("goup:idempotency:"+key, value, ttl).Err()
+}
+
+func (s *redisIdempotencyStore) lock(key, owner string, ttl time.Duration) (bool, error) {
+	client, err := s.client()
+	if err != nil {
+		return false, err
+	}
+	return util.NewDLock(client, "goup:idempotency:"+key, owner).TryLock(ttl)
+}
+
+func (s *redisIdempotencyStore) refresh(key, owner string, ttl time.Duration) (bool, error) {
+	client, err := s.client()
+	if err != nil {
+		return false, err
+	}
+	return util.NewDLock(client, "goup:idempotency:"+key, owner).Refresh(ttl)
+}
+
+func (s *redisIdempotencyStore) unlock(key, owner string) error {
+	client, err := s.client()
+	if err != nil {
+		return err
+	}
+	_, err = util.NewDLock(client, "goup:idempotency:"+key, owner).ReleaseLock()
+	return err
+}
+
+// localIdempotencyStore 进程内的存储，用于测试
+type localIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*idempotentRecord
+	locks   map[string]string
+}
+
+func newLocalIdempotencyStore() *localIdempotencyStore {
+	return &localIdempotencyStore{
+		records: map[string]*idempotentRecord{},
+		locks:   map[string]string{},
+	}
+}
+
+func (s *localIdempotencyStore) get(key string) (*idempotentRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records[key], nil
+}
+
+func (s *localIdempotencyStore) save(key string, record *idempotentRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = record
+	return nil
+}
+
+func (s *localIdempotencyStore) lock(key, owner string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.locks[key]; ok {
+		return false, nil
+	}
+	s.locks[key] = owner
+	return true, nil
+}
+
+func (s *localIdempotencyStore) refresh(key, owner string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.locks[key] == owner, nil
+}
+
+func (s *localIdempotencyStore) unlock(key, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locks[key] == owner {
+		delete(s.locks, key)
+	}
+	return nil
+}
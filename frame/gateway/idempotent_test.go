@@ -0,0 +1,199 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newIdempotentTestContext(key, body string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/order/create", bytes.NewBufferString(body))
+	c.Request.Header.Set(IdempotencyKeyHeader, key)
+	// 和绑定参数时一样缓存 body
+	c.Set(gin.BodyBytesKey, []byte(body))
+	return c, w
+}
+
+func TestIdempotentReplay(t *testing.T) {
+	store := newLocalIdempotencyStore()
+	idem := &idempotency{store: store}
+	apiContext := &ApiContext{AppKey: "app", respHeaders: map[string]string{"X-Order": "1"}}
+
+	c, w := newIdempotentTestContext("k1", `{"amount":1}`)
+	req, done := idem.begin(c, apiContext, "order.create")
+	if done || req == nil {
+		t.Fatal("first request should be processed")
+	}
+	c.JSON(http.StatusCreated, gin.H{"orderId": 1})
+	req.finish(c)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+
+	// 重试时返回保存的响应
+	c, w = newIdempotentTestContext("k1", `{"amount":1}`)
+	if _, done := idem.begin(c, apiContext, "order.create"); !done {
+		t.Fatal("retry should be replayed")
+	}
+	if w.Code != http.StatusCreated || w.Body.String() != `{"orderId":1}` {
+		t.Fatalf("unexpected replay: %d %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get(idempotentReplayedHeader) != "true" || w.Header().Get("X-Order") != "1" {
+		t.Fatalf("unexpected headers: %v", w.Header())
+	}
+
+	// 参数不同
+	_, idemErr, err := idem.lookup("order.create:app:k1", idempotentHash(c.Request, []byte(`{"amount":2}`)))
+	if err != nil || idemErr != errIdempotencyKeyReused {
+		t.Fatalf("expected key reused error, got %v %v", idemErr, err)
+	}
+
+	// 其他调用方使用相同的幂等键不受影响
+	c, _ = newIdempotentTestContext("k1", `{"amount":1}`)
+	req, done = idem.begin(c, &ApiContext{AppKey: "other"}, "order.create")
+	if done || req == nil {
+		t.Fatal("other caller should be processed")
+	}
+	req.finish(c)
+}
+
+func TestIdempotentNotSaved(t *testing.T) {
+	store := newLocalIdempotencyStore()
+	idem := &idempotency{store: store}
+	apiContext := &ApiContext{AppKey: "app"}
+
+	// 处理中加锁
+	c, _ := newIdempotentTestContext("k1", `{}`)
+	req, _ := idem.begin(c, apiContext, "order.create")
+	if ok, _ := store.lock("order.create:app:k1", "other", 0); ok {
+		t.Fatal("in-flight request should hold the lock")
+	}
+
+	// 5xx 不保存，释放锁后可以重试
+	c.JSON(http.StatusInternalServerError, gin.H{})
+	req.finish(c)
+	if record, _ := store.get("order.create:app:k1"); record != nil {
+		t.Fatal("5xx response should not be saved")
+	}
+
+	// 没有写入响应（panic）时不保存
+	c, _ = newIdempotentTestContext("k1", `{}`)
+	req, done := idem.begin(c, apiContext, "order.create")
+	if done {
+		t.Fatal("request should be processed after 5xx")
+	}
+	req.finish(c)
+	if record, _ := store.get("order.create:app:k1"); record != nil {
+		t.Fatal("unwritten response should not be saved")
+	}
+	if ok, _ := store.lock("order.create:app:k1", "other", 0); !ok {
+		t.Fatal("lock should be released")
+	}
+
+	// 没有幂等键时不处理
+	c, _ = newIdempotentTestContext("", `{}`)
+	if req, done := idem.begin(c, apiContext, "order.create"); req != nil || done {
+		t.Fatal("request without key should be ignored")
+	}
+}
+
+func TestIdempotentAnonymousCallers(t *testing.T) {
+	idem := &idempotency{store: newLocalIdempotencyStore()}
+
+	// 第一个匿名调用方的响应
+	c, _ := newIdempotentTestContext("k1", `{"amount":1}`)
+	req, done := idem.begin(c, &ApiContext{}, "order.create")
+	if req != nil || done {
+		t.Fatal("anonymous request should not be idempotent")
+	}
+	c.JSON(http.StatusCreated, gin.H{"orderId": 1})
+
+	// 第二个匿名调用方使用相同的幂等键，不会拿到第一个调用方的响应
+	c, w := newIdempotentTestContext("k1", `{"amount":1}`)
+	if _, done := idem.begin(c, &ApiContext{}, "order.create"); done || w.Header().Get(idempotentReplayedHeader) != "" {
+		t.Fatal("anonymous callers should not share idempotency keys")
+	}
+}
+
+func TestIdempotentTimeout(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	Register("idempotent", "timeout", "timeout api", func(c *ApiContext, req *registerRequest) (*registerResponse, error) {
+		atomic.AddInt32(&calls, 1)
+		// 不处理 ctx，超时后继续执行
+		<-release
+		return &registerResponse{}, nil
+	}, Timeout(50*time.Millisecond), Idempotent(time.Hour), HandlerFunc(func(c *gin.Context, apiContext *ApiContext) *Resp {
+		apiContext.AppKey = "app"
+		return nil
+	}))
+	apiHandlerFuncMap["idempotent.timeout"].idempotency.store = newLocalIdempotencyStore()
+
+	r := newTestAPIEngine()
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/idempotent/timeout", bytes.NewBufferString(`{"message":"hello"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(IdempotencyKeyHeader, "k1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := serve(); w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("first request should time out, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Handler 还在执行和执行完成之后，重试都不会再次执行
+	for i := 0; i < 2; i++ {
+		w := serve()
+		var resp Resp
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != http.StatusConflict || resp.Code != ErrIdempotencyInProgress {
+			t.Fatalf("retry after timeout = %d %s", w.Code, w.Body.String())
+		}
+		if i == 0 {
+			close(release)
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("handler should run once, got %d", n)
+	}
+}
+
+func TestIdempotentRefreshLock(t *testing.T) {
+	store := newLocalIdempotencyStore()
+	idem := &idempotency{lockTTL: 30 * time.Millisecond, store: &countingIdempotencyStore{localIdempotencyStore: store}}
+
+	c, _ := newIdempotentTestContext("k1", `{}`)
+	req, _ := idem.begin(c, &ApiContext{AppKey: "app"}, "order.create")
+	time.Sleep(50 * time.Millisecond)
+	req.finish(c)
+
+	refreshed := atomic.LoadInt32(&idem.store.(*countingIdempotencyStore).refreshed)
+	if refreshed == 0 {
+		t.Fatal("lock should be refreshed while the request is processing")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if atomic.LoadInt32(&idem.store.(*countingIdempotencyStore).refreshed) != refreshed {
+		t.Fatal("lock should not be refreshed after finish")
+	}
+}
+
+// countingIdempotencyStore 记录续期的次数
+type countingIdempotencyStore struct {
+	*localIdempotencyStore
+	refreshed int32
+}
+
+func (s *countingIdempotencyStore) refresh(key, owner string, ttl time.Duration) (bool, error) {
+	atomic.AddInt32(&s.refreshed, 1)
+	return s.localIdempotencyStore.refresh(key, owner, ttl)
+}
@@ -0,0 +1,526 @@
+package gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/xbonlinenet/goup/frame/log"
+)
+
+var (
+	errJWTMissing   = NewError(ErrUnauthorized, "缺少登录凭证").WithStatus(http.StatusUnauthorized)
+	errJWTInvalid   = NewError(ErrUnauthorized, "登录凭证无效或已过期").WithStatus(http.StatusUnauthorized)
+	errJWTNoScope   = NewError(ErrAppNotAuthed, "没有调用该接口的权限").WithStatus(http.StatusForbidden)
+	errJWTKeyNotSet = errors.New("jwt key not found")
+)
+
+const (
+	// jwksCheckInterval JWKS 文件变化的检查间隔，未知的 kid 触发的立即检查也受该间隔限制
+	jwksCheckInterval = 10 * time.Second
+	// jwtInitRetryInterval 加载配置或者密钥失败后重试的间隔
+	jwtInitRetryInterval = time.Second
+)
+
+// JWTConfig JWT 鉴权配置，默认从配置文件 gateway.jwt 中读取
+//
+//	gateway:
+//	  jwt:
+//	    secret: xxxx
+//	    public_keys:
+//	      key-2024: PEM 格式的 RSA/ECDSA 公钥
+//	    jwks_file: /etc/goup/jwks.json
+//	    cookie: token
+//	    issuer: https://login.example.com
+type JWTConfig struct {
+	// Secret HS256 的密钥
+	Secret string `mapstructure:"secret"`
+	// PublicKeys RS256/ES256 的公钥，key 为 kid
+	PublicKeys map[string]string `mapstructure:"public_keys"`
+	// JWKSFile 本地 JWKS 文件，文件修改后自动重新加载，用于密钥轮换
+	JWKSFile string `mapstructure:"jwks_file"`
+	// Cookie Authorization 请求头中没有 token 时，从该 Cookie 中读取
+	Cookie string `mapstructure:"cookie"`
+	// UserIDClaim 用户 ID 对应的 claim，默认为 sub
+	UserIDClaim string `mapstructure:"user_id_claim"`
+	// Issuer、Audience 不为空时校验 iss、aud
+	Issuer   string `mapstructure:"issuer"`
+	Audience string `mapstructure:"audience"`
+	// Leeway 校验 exp、nbf 时允许的时钟误差
+	Leeway time.Duration `mapstructure:"leeway"`
+}
+
+// Claims 校验通过的 JWT claims
+type Claims map[string]interface{}
+
+// Subject sub claim
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+// String 获取字符串类型的 claim
+func (c Claims) String(key string) string {
+	switch v := c[key].(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Scopes 支持空格分隔的 scope，以及数组形式的 scp、scopes
+func (c Claims) Scopes() []string {
+	if scope, ok := c["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+
+	for _, key := range []string{"scp", "scopes"} {
+		switch v := c[key].(type) {
+		case string:
+			return strings.Fields(v)
+		case []interface{}:
+			scopes := make([]string, 0, len(v))
+			for _, s := range v {
+				if s, ok := s.(string); ok {
+					scopes = append(scopes, s)
+				}
+			}
+			return scopes
+		}
+	}
+	return nil
+}
+
+// HasScope 是否拥有 scope
+func (c Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Claims JWT 鉴权通过后的 claims，没有使用 JWTAuth 时为 nil
+func (c *ApiContext) Claims() Claims {
+	return c.claims
+}
+
+// UserID JWT 中的用户 ID
+func (c *ApiContext) UserID() string {
+	return c.userID
+}
+
+// Scopes JWT 中的 scope
+func (c *ApiContext) Scopes() []string {
+	return c.claims.Scopes()
+}
+
+// HasScope JWT 中是否拥有 scope
+func (c *ApiContext) HasScope(scope string) bool {
+	return c.claims.HasScope(scope)
+}
+
+// JWTAuthenticator 校验 HS256/RS256/ES256 签名的 JWT
+type JWTAuthenticator struct {
+	mutex       sync.RWMutex
+	load        func() (JWTConfig, error)
+	config      JWTConfig
+	keys        *jwtKeySet
+	err         error
+	lastAttempt time.Time
+}
+
+// NewJWTAuthenticator 使用指定的配置创建 JWT 鉴权
+func NewJWTAuthenticator(config JWTConfig) *JWTAuthenticator {
+	return &JWTAuthenticator{
+		load: func() (JWTConfig, error) {
+			return config, nil
+		},
+	}
+}
+
+// NewConfigJWTAuthenticator 从配置文件 gateway.jwt 中读取配置，在第一次请求时加载
+func NewConfigJWTAuthenticator() *JWTAuthenticator {
+	return &JWTAuthenticator{
+		load: func() (JWTConfig, error) {
+			var config JWTConfig
+			err := viper.UnmarshalKey("gateway.jwt", &config)
+			return config, err
+		},
+	}
+}
+
+// JWTAuth 接口需要登录，token 从 Authorization: Bearer 请求头或者配置的 Cookie 中读取；
+// 指定 scopes 时，token 需要拥有所有的 scope，否则返回 ErrAppNotAuthed
+func JWTAuth(auth *JWTAuthenticator, scopes ...string) Option {
+	return HandlerFunc(func(c *gin.Context, apiContext *ApiContext) *Resp {
+		if err := auth.authenticate(c, apiContext, scopes); err != nil {
+			if err.HTTPStatus() == http.StatusUnauthorized {
+				c.Header("WWW-Authenticate", "Bearer")
+			}
+			status, resp := errorResp(err)
+			resp.status = status
+			return &resp
+		}
+		return nil
+	})
+}
+
+// init 加载配置和密钥，成功之后不再加载；失败时最多每隔 jwtInitRetryInterval 重试一次
+func (a *JWTAuthenticator) init() error {
+	a.mutex.RLock()
+	ready := a.keys != nil
+	a.mutex.RUnlock()
+	if ready {
+		return nil
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.keys != nil {
+		return nil
+	}
+	if a.err != nil && time.Since(a.lastAttempt) < jwtInitRetryInterval {
+		return a.err
+	}
+	a.lastAttempt = time.Now()
+
+	config, err := a.load()
+	if err != nil {
+		a.err = err
+		return err
+	}
+	if config.UserIDClaim == "" {
+		config.UserIDClaim = "sub"
+	}
+	keys, err := newJWTKeySet(config)
+	if err != nil {
+		a.err = err
+		return err
+	}
+	a.config, a.keys, a.err = config, keys, nil
+	return nil
+}
+
+// Parse 校验 token 并返回 claims
+func (a *JWTAuthenticator) Parse(token string) (Claims, error) {
+	if err := a.init(); err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"HS256", "RS256", "ES256"}), jwt.WithoutClaimsValidation())
+	if _, err := parser.ParseWithClaims(token, claims, a.keys.keyFunc); err != nil {
+		return nil, err
+	}
+
+	if err := a.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return Claims(claims), nil
+}
+
+// validateClaims jwt v4 不支持时钟误差，exp、nbf 等在这里校验
+func (a *JWTAuthenticator) validateClaims(claims jwt.MapClaims) error {
+	now := time.Now()
+	leeway := a.config.Leeway
+
+	if !claims.VerifyExpiresAt(now.Add(-leeway).Unix(), false) {
+		return errors.New("token is expired")
+	}
+	if !claims.VerifyNotBefore(now.Add(leeway).Unix(), false) {
+		return errors.New("token is not valid yet")
+	}
+	if !claims.VerifyIssuedAt(now.Add(leeway).Unix(), false) {
+		return errors.New("token used before issued")
+	}
+	if a.config.Issuer != "" && !claims.VerifyIssuer(a.config.Issuer, true) {
+		return errors.New("invalid issuer")
+	}
+	if a.config.Audience != "" && !claims.VerifyAudience(a.config.Audience, true) {
+		return errors.New("invalid audience")
+	}
+	return nil
+}
+
+func (a *JWTAuthenticator) authenticate(c *gin.Context, apiContext *ApiContext, scopes []string) *Error {
+	if err := a.init(); err != nil {
+		log.Default().Error("init jwt authenticator error", zap.Error(err))
+		return errJWTInvalid
+	}
+
+	token := bearerToken(c.GetHeader("Authorization"))
+	if token == "" && a.config.Cookie != "" {
+		token, _ = c.Cookie(a.config.Cookie)
+	}
+	if token == "" {
+		return errJWTMissing
+	}
+
+	claims, err := a.Parse(token)
+	if err != nil {
+		log.Default().Info("invalid jwt", zap.String("path", c.Request.URL.Path), zap.Error(err))
+		return errJWTInvalid
+	}
+
+	for _, scope := range scopes {
+		if !claims.HasScope(scope) {
+			return errJWTNoScope
+		}
+	}
+
+	apiContext.claims = claims
+	apiContext.userID = claims.String(a.config.UserIDClaim)
+	return nil
+}
+
+func bearerToken(header string) string {
+	const prefix = "bearer "
+	if len(header) > len(prefix) && strings.EqualFold(header[:len(prefix)], prefix) {
+		return strings.TrimSpace(header[len(prefix):])
+	}
+	return ""
+}
+
+// jwtKeySet 配置中的密钥以及 JWKS 文件中的密钥
+// 配置文件的 key 会被 viper 转为小写，kid 统一按小写匹配
+type jwtKeySet struct {
+	secret     []byte
+	publicKeys map[string]interface{}
+
+	jwksFile  string
+	mutex     sync.RWMutex
+	jwks      map[string]interface{}
+	modTime   time.Time
+	lastCheck time.Time
+	// lastForce 上次因为未知的 kid 立即检查的时间，防止随机的 kid 不断触发读取文件
+	lastForce time.Time
+}
+
+func newJWTKeySet(config JWTConfig) (*jwtKeySet, error) {
+	s := &jwtKeySet{
+		secret:     []byte(config.Secret),
+		publicKeys: make(map[string]interface{}, len(config.PublicKeys)),
+		jwksFile:   config.JWKSFile,
+	}
+
+	for kid, pem := range config.PublicKeys {
+		key, err := parsePublicKeyPEM([]byte(pem))
+		if err != nil {
+			return nil, fmt.Errorf("parse jwt public key %s: %w", kid, err)
+		}
+		s.publicKeys[strings.ToLower(kid)] = key
+	}
+
+	if s.jwksFile != "" {
+		s.mutex.Lock()
+		err := s.loadJWKS()
+		s.mutex.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func parsePublicKeyPEM(pem []byte) (interface{}, error) {
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(pem); err == nil {
+		return key, nil
+	}
+	return jwt.ParseECPublicKeyFromPEM(pem)
+}
+
+// keyFunc 根据 alg 和 kid 选择密钥，token 没有 kid 时只能有一个同类型的密钥
+func (s *jwtKeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	kid = strings.ToLower(kid)
+
+	key, err := s.find(token.Method.Alg(), kid)
+	if err == errJWTKeyNotSet && s.jwksFile != "" {
+		// 可能是新轮换的密钥，立即检查 JWKS 文件
+		if reloadErr := s.reloadJWKS(true); reloadErr != nil {
+			log.Default().Warn("reload jwks error", zap.String("file", s.jwksFile), zap.Error(reloadErr))
+		}
+		key, err = s.find(token.Method.Alg(), kid)
+	}
+	return key, err
+}
+
+func (s *jwtKeySet) find(alg, kid string) (interface{}, error) {
+	if s.jwksFile != "" {
+		if err := s.reloadJWKS(false); err != nil {
+			log.Default().Warn("reload jwks error", zap.String("file", s.jwksFile), zap.Error(err))
+		}
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var candidates []interface{}
+	for _, keys := range []map[string]interface{}{s.jwks, s.publicKeys} {
+		for k, key := range keys {
+			if (kid == "" || k == kid) && jwtKeyMatches(alg, key) {
+				candidates = append(candidates, key)
+			}
+		}
+	}
+	if alg == "HS256" && len(s.secret) > 0 && (kid == "" || len(candidates) == 0) {
+		candidates = append(candidates, s.secret)
+	}
+
+	if len(candidates) != 1 {
+		return nil, errJWTKeyNotSet
+	}
+	return candidates[0], nil
+}
+
+func jwtKeyMatches(alg string, key interface{}) bool {
+	switch key.(type) {
+	case []byte:
+		return alg == "HS256"
+	case *rsa.PublicKey:
+		return alg == "RS256"
+	case *ecdsa.PublicKey:
+		return alg == "ES256"
+	}
+	return false
+}
+
+// reloadJWKS 文件修改时间变化后重新加载，按 jwksCheckInterval 检查；
+// force 为 true 时不等待检查间隔，但每个 jwksCheckInterval 内最多立即检查一次
+func (s *jwtKeySet) reloadJWKS(force bool) error {
+	s.mutex.RLock()
+	skip := time.Since(s.lastCheck) < jwksCheckInterval && (!force || time.Since(s.lastForce) < jwksCheckInterval)
+	s.mutex.RUnlock()
+	if skip {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if time.Since(s.lastCheck) < jwksCheckInterval {
+		if !force || time.Since(s.lastForce) < jwksCheckInterval {
+			return nil
+		}
+		s.lastForce = time.Now()
+	}
+	return s.loadJWKS()
+}
+
+// loadJWKS 加载 JWKS 文件，调用方需要持有写锁
+func (s *jwtKeySet) loadJWKS() error {
+	s.lastCheck = time.Now()
+
+	info, err := os.Stat(s.jwksFile)
+	if err != nil {
+		return err
+	}
+	if s.jwks != nil && info.ModTime().Equal(s.modTime) {
+		return nil
+	}
+
+	content, err := os.ReadFile(s.jwksFile)
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(content)
+	if err != nil {
+		return err
+	}
+
+	s.jwks = keys
+	s.modTime = info.ModTime()
+	return nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS 解析 JWKS，只支持 oct、RSA 和 P-256 的 EC 密钥
+func parseJWKS(content []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []*jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("parse jwk %s: %w", k.Kid, err)
+		}
+		keys[strings.ToLower(k.Kid)] = key
+	}
+	return keys, nil
+}
+
+func (k *jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
@@ -0,0 +1,153 @@
+package gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestJWTAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	auth := NewJWTAuthenticator(JWTConfig{Secret: "secret", Cookie: "token", UserIDClaim: "uid"})
+	sign := func(claims jwt.MapClaims) string {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		return token
+	}
+	valid := sign(jwt.MapClaims{"uid": "1001", "scope": "read write", "exp": time.Now().Add(time.Hour).Unix()})
+
+	tests := []struct {
+		name   string
+		header string
+		cookie string
+		scopes []string
+		code   int
+		status int
+	}{
+		{name: "bearer header", header: "Bearer " + valid, scopes: []string{"read"}},
+		{name: "cookie", cookie: valid},
+		{name: "missing token", code: ErrUnauthorized, status: http.StatusUnauthorized},
+		{name: "bad signature", header: "Bearer " + valid + "x", code: ErrUnauthorized, status: http.StatusUnauthorized},
+		{
+			name:   "expired",
+			header: "Bearer " + sign(jwt.MapClaims{"uid": "1001", "exp": time.Now().Add(-time.Hour).Unix()}),
+			code:   ErrUnauthorized,
+			status: http.StatusUnauthorized,
+		},
+		{name: "missing scope", header: "Bearer " + valid, scopes: []string{"admin"}, code: ErrAppNotAuthed, status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &HandlerInfo{}
+			JWTAuth(auth, tt.scopes...).apply(handler)
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request, _ = http.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				c.Request.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				c.Request.AddCookie(&http.Cookie{Name: "token", Value: tt.cookie})
+			}
+
+			apiContext := &ApiContext{}
+			resp := handler.preHandlers[0](c, apiContext)
+			if tt.code == 0 {
+				if resp != nil {
+					t.Fatalf("unexpected resp: %+v", resp)
+				}
+				if apiContext.UserID() != "1001" || !apiContext.HasScope("write") {
+					t.Errorf("claims not set: %v", apiContext.Claims())
+				}
+				return
+			}
+			if resp == nil || resp.Code != tt.code || resp.status != tt.status {
+				t.Errorf("resp = %+v, want code %d status %d", resp, tt.code, tt.status)
+			}
+		})
+	}
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS := func(kid string, key *ecdsa.PrivateKey, modTime time.Time) {
+		content := fmt.Sprintf(`{"keys":[{"kty":"EC","kid":%q,"crv":"P-256","x":%q,"y":%q}]}`, kid,
+			base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))))
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(file, modTime, modTime)
+	}
+	sign := func(kid string, key *ecdsa.PrivateKey) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"sub": "1001"})
+		token.Header["kid"] = kid
+		signed, _ := token.SignedString(key)
+		return signed
+	}
+
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	writeJWKS("k1", oldKey, time.Now().Add(-time.Hour))
+	auth := NewJWTAuthenticator(JWTConfig{JWKSFile: file})
+
+	if claims, err := auth.Parse(sign("k1", oldKey)); err != nil || claims.Subject() != "1001" {
+		t.Fatalf("parse with old key: %v, %v", claims, err)
+	}
+
+	writeJWKS("k2", newKey, time.Now())
+	if _, err := auth.Parse(sign("k2", newKey)); err != nil {
+		t.Fatalf("parse with rotated key: %v", err)
+	}
+	if _, err := auth.Parse(sign("k1", oldKey)); err == nil {
+		t.Errorf("removed key should be rejected")
+	}
+
+	// 未知的 kid 每个检查间隔内最多触发一次立即检查
+	thirdKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	writeJWKS("k3", thirdKey, time.Now().Add(time.Minute))
+	if _, err := auth.Parse(sign("k3", thirdKey)); err == nil {
+		t.Errorf("forced reload should be rate limited")
+	}
+	auth.keys.lastForce = time.Now().Add(-jwksCheckInterval)
+	if _, err := auth.Parse(sign("k3", thirdKey)); err != nil {
+		t.Fatalf("parse after check interval: %v", err)
+	}
+}
+
+func TestJWTInitRetry(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	auth := NewJWTAuthenticator(JWTConfig{JWKSFile: file})
+	if err := auth.init(); err == nil {
+		t.Fatal("init should fail without jwks file")
+	}
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	content := fmt.Sprintf(`{"keys":[{"kty":"EC","kid":"k1","crv":"P-256","x":%q,"y":%q}]}`,
+		base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))))
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重试间隔内返回上次的错误
+	if err := auth.init(); err == nil {
+		t.Fatal("init should not retry within the retry interval")
+	}
+	auth.lastAttempt = time.Now().Add(-jwtInitRetryInterval)
+	if err := auth.init(); err != nil {
+		t.Fatalf("init should succeed after retry: %v", err)
+	}
+}
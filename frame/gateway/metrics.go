@@ -0,0 +1,212 @@
+package gateway
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+const (
+	// metricsAPIKey gin.Context 中保存的接口名，用作指标的 api 标签
+	metricsAPIKey = "goup:metrics_api"
+	// resultCodeKey gin.Context 中保存的业务结果码
+	resultCodeKey = "goup:result_code"
+	// unknownAPI 没有找到接口时使用的标签，避免使用原始路径导致标签无限增长
+	unknownAPI = "unknown"
+)
+
+var (
+	defaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .15, .2, .25, .5, 1, 2.5, 5, 10}
+	// defaultSizeBuckets 128B ~ 2MB
+	defaultSizeBuckets = prometheus.ExponentialBuckets(128, 4, 8)
+)
+
+// requestLatency 接口延迟
+var requestLatency = newLatencyHistogram(defaultLatencyBuckets)
+
+// invalidRequestCounter 统计错误请求数量情况，path 为接口名
+var invalidRequestCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "invalid_request",
+	Help: "invalid request by api and code",
+}, []string{"path", "code"})
+
+// rateLimitedCounter 统计被限流的请求数量
+var rateLimitedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "rate_limited_request",
+	Help: "rate limited request by api",
+}, []string{"api"})
+
+// apiRequestCounter 按业务结果码统计接口请求，成功为 0
+var apiRequestCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "api_request",
+	Help: "api request by api and result code",
+}, []string{"api", "code"})
+
+// apiInFlight 正在处理的请求数量
+var apiInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "api_in_flight",
+	Help: "in-flight api request",
+}, []string{"api"})
+
+// preHandlerRejectedCounter PreHandler 拒绝的请求数量
+var preHandlerRejectedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "prehandler_rejected_request",
+	Help: "request rejected by prehandler",
+}, []string{"api", "code"})
+
+// apiPanicCounter 处理请求时 panic 的次数
+var apiPanicCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "api_panic",
+	Help: "panic count by api",
+}, []string{"api"})
+
+// handlerOverrunCounter 超时之后才返回的 Handler，Handler 没有处理 ApiContext.Done() 时 goroutine 会继续执行
+var handlerOverrunCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "api_handler_overrun",
+	Help: "handler returned after api timeout",
+}, []string{"api"})
+
+// 请求和响应的大小，单位为字节
+var (
+	requestSize  = newSizeHistogram("api_request_size", "api request body size in bytes", defaultSizeBuckets)
+	responseSize = newSizeHistogram("api_response_size", "api response body size in bytes", defaultSizeBuckets)
+)
+
+func newLatencyHistogram(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "request_latency",
+		Help:    "stat request latency by seconds",
+		Buckets: buckets,
+	}, []string{"api"})
+}
+
+func newSizeHistogram(name, help string, buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    name,
+		Help:    help,
+		Buckets: buckets,
+	}, []string{"api"})
+}
+
+var registerMetricsOnce sync.Once
+
+// registerMetrics 注册网关的指标，需要在配置加载之后调用。
+//
+// 直方图的 buckets 使用 gateway.metrics.latency_buckets、gateway.metrics.size_buckets 配置，
+// 所有指标带有 app 标签，值为 application.name
+func registerMetrics() {
+	registerMetricsOnce.Do(func() {
+		if buckets := metricsBuckets("gateway.metrics.latency_buckets"); len(buckets) > 0 {
+			requestLatency = newLatencyHistogram(buckets)
+		}
+		if buckets := metricsBuckets("gateway.metrics.size_buckets"); len(buckets) > 0 {
+			requestSize = newSizeHistogram("api_request_size", "api request body size in bytes", buckets)
+			responseSize = newSizeHistogram("api_response_size", "api response body size in bytes", buckets)
+		}
+
+		registerer := prometheus.DefaultRegisterer
+		if app := viper.GetString("application.name"); app != "" {
+			registerer = prometheus.WrapRegistererWith(prometheus.Labels{"app": app}, registerer)
+		}
+		registerer.MustRegister(
+			requestLatency,
+			invalidRequestCounter,
+			rateLimitedCounter,
+			apiRequestCounter,
+			apiInFlight,
+			preHandlerRejectedCounter,
+			apiPanicCounter,
+			handlerOverrunCounter,
+			requestSize,
+			responseSize,
+			responseCacheCounter,
+			bodyTooLargeCounter,
+		)
+	})
+}
+
+// metricsBuckets 读取配置的 buckets，没有配置时返回空
+func metricsBuckets(key string) []float64 {
+	values := cast.ToSlice(viper.Get(key))
+	buckets := make([]float64, 0, len(values))
+	for _, v := range values {
+		buckets = append(buckets, cast.ToFloat64(v))
+	}
+	sort.Float64s(buckets)
+	return buckets
+}
+
+// metricsAPI 请求的接口名，没有找到接口时为 unknown
+func metricsAPI(c *gin.Context) string {
+	if api := c.GetString(metricsAPIKey); api != "" {
+		return api
+	}
+	return unknownAPI
+}
+
+// MetricsLabel 请求在指标中使用的标签：网关接口为接口名，其他路由为路由模板，没有匹配的路由时为 unknown
+func MetricsLabel(c *gin.Context) string {
+	if api := c.GetString(metricsAPIKey); api != "" {
+		return api
+	}
+	if path := c.FullPath(); path != "" {
+		return path
+	}
+	return unknownAPI
+}
+
+// setResultCode 记录请求的业务结果码
+func setResultCode(c *gin.Context, code int) {
+	c.Set(resultCodeKey, code)
+}
+
+// resultCode 响应中的业务结果码，不是 Resp 的响应视为成功
+func resultCode(response interface{}) int {
+	switch resp := response.(type) {
+	case Resp:
+		return resp.Code
+	case *Resp:
+		if resp != nil {
+			return resp.Code
+		}
+	}
+	return ErrOK
+}
+
+// beginRequestMetrics 找到接口后开始统计，返回的函数在请求结束时调用
+func beginRequestMetrics(c *gin.Context, apiKey string) func() {
+	c.Set(metricsAPIKey, apiKey)
+	apiInFlight.WithLabelValues(apiKey).Inc()
+
+	return func() {
+		apiInFlight.WithLabelValues(apiKey).Dec()
+
+		code, ok := c.Get(resultCodeKey)
+		if !ok {
+			// 没有写入响应说明处理过程中 panic 了
+			code = ErrOK
+			if !c.Writer.Written() {
+				code = ErrUnknowError
+			}
+		}
+		apiRequestCounter.WithLabelValues(apiKey, strconv.Itoa(cast.ToInt(code))).Inc()
+
+		size := c.Request.ContentLength
+		if body, ok := c.Get(gin.BodyBytesKey); ok {
+			if b, ok := body.([]byte); ok {
+				size = int64(len(b))
+			}
+		}
+		if size >= 0 {
+			requestSize.WithLabelValues(apiKey).Observe(float64(size))
+		}
+		if n := c.Writer.Size(); n >= 0 {
+			responseSize.WithLabelValues(apiKey).Observe(float64(n))
+		}
+	}
+}
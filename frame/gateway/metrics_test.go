@@ -0,0 +1,84 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+)
+
+func TestResultCode(t *testing.T) {
+	cases := []struct {
+		response interface{}
+		code     int
+	}{
+		{Resp{Code: ErrInvalidParam}, ErrInvalidParam},
+		{&Resp{Code: ErrLogicError}, ErrLogicError},
+		{(*Resp)(nil), ErrOK},
+		{gin.H{"id": 1}, ErrOK},
+		{nil, ErrOK},
+	}
+	for _, tc := range cases {
+		if code := resultCode(tc.response); code != tc.code {
+			t.Errorf("resultCode(%#v) = %d, want %d", tc.response, code, tc.code)
+		}
+	}
+}
+
+func TestMetricsLabel(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/user/1", nil)
+	if label := MetricsLabel(c); label != unknownAPI {
+		t.Fatalf("unmatched request label = %q", label)
+	}
+	c.Set(metricsAPIKey, "user.get")
+	if label := MetricsLabel(c); label != "user.get" {
+		t.Fatalf("api label = %q", label)
+	}
+}
+
+func TestMetricsBuckets(t *testing.T) {
+	viper.Set("gateway.metrics.latency_buckets", []interface{}{1, "0.5", 0.1})
+	defer viper.Set("gateway.metrics.latency_buckets", nil)
+
+	buckets := metricsBuckets("gateway.metrics.latency_buckets")
+	if len(buckets) != 3 || buckets[0] != 0.1 || buckets[1] != 0.5 || buckets[2] != 1 {
+		t.Fatalf("unexpected buckets %v", buckets)
+	}
+	if buckets := metricsBuckets("gateway.metrics.size_buckets"); len(buckets) != 0 {
+		t.Fatalf("unexpected buckets %v", buckets)
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	const api = "metrics.test"
+	requests := func(code int) float64 {
+		return testutil.ToFloat64(apiRequestCounter.WithLabelValues(api, strconv.Itoa(code)))
+	}
+
+	// 正常响应
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/metrics/test", nil)
+	done := beginRequestMetrics(c, api)
+	if testutil.ToFloat64(apiInFlight.WithLabelValues(api)) != 1 {
+		t.Fatal("request should be in flight")
+	}
+	setResultCode(c, resultCode(Resp{Code: ErrOK}))
+	c.JSON(http.StatusOK, gin.H{})
+	done()
+	if testutil.ToFloat64(apiInFlight.WithLabelValues(api)) != 0 || requests(ErrOK) != 1 {
+		t.Fatal("request should be counted as ok")
+	}
+
+	// 没有写入响应（panic）
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/metrics/test", nil)
+	beginRequestMetrics(c, api)()
+	if requests(ErrUnknowError) != 1 {
+		t.Fatal("unwritten response should be counted as unknown error")
+	}
+}
@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -18,7 +20,6 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cast"
 	"go.uber.org/zap"
 
@@ -26,6 +27,7 @@ import (
 	"github.com/xbonlinenet/goup/frame/log"
 	"github.com/xbonlinenet/goup/frame/perf"
 	"github.com/xbonlinenet/goup/frame/recovery"
+	"github.com/xbonlinenet/goup/frame/tracing"
 	"github.com/xbonlinenet/goup/frame/util"
 )
 
@@ -33,6 +35,9 @@ var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
 var (
 	apiHandlerFuncMap = map[string]*HandlerInfo{}
+
+	// apiPathPrefix 接口路径前缀，用于生成文档
+	apiPathPrefix = kDefaultApiPathPrefix
 )
 
 const (
@@ -41,25 +46,6 @@ const (
 	MaxRespLen               = 512
 )
 
-func init() {
-	prometheus.MustRegister(requestLatency)
-	prometheus.MustRegister(invalidRequestCounter)
-
-}
-
-// requestLatency 接口延迟
-var requestLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-	Name:    "request_latency",
-	Help:    "stat request latency by seconds",
-	Buckets: []float64{.005, .01, .025, .05, .1, .15, .2, .25, .5, 1, 2.5, 5, 10},
-}, []string{"api"})
-
-// invalidRequestCounter 统计错误请求数量情况
-var invalidRequestCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
-	Name: "invalid_request",
-	Help: "invalid request by path and code",
-}, []string{"path", "code"})
-
 // APIMiddleware 接口中间层
 func APIMiddleware(customApiPathPrefix string) gin.HandlerFunc {
 	if customApiPathPrefix == "" {
@@ -73,6 +59,8 @@ func APIMiddleware(customApiPathPrefix string) gin.HandlerFunc {
 			customApiPathPrefix = customApiPathPrefix + "/"
 		}
 	}
+	apiPathPrefix = customApiPathPrefix
+	registerMetrics()
 
 	return func(c *gin.Context) {
 		if customApiPathPrefix == kAnyApiPathPrefixAllowed ||
@@ -117,6 +105,7 @@ func handlerApiRequest(c *gin.Context, apiPathPrefix string) {
 
 	defer func() {
 		if err := recover(); err != nil {
+			apiPanicCounter.WithLabelValues(metricsAPI(c)).Inc()
 			elapsedDuration := time.Since(start)
 			stack := recovery.Stack(3)
 
@@ -169,12 +158,31 @@ func handlerApiRequest(c *gin.Context, apiPathPrefix string) {
 	// 判断是否有路由可以处理
 	apiKey := getAPIKey(c.Request.URL.Path, apiPathPrefix)
 	apiHandlerInfo, ok := apiHandlerFuncMap[apiKey]
+	// RESTful 接口只能通过路径模板访问
+	if ok && apiHandlerInfo.route != nil {
+		ok = false
+	}
+
+	var pathParams gin.Params
 	if !ok {
-		c.Next()
-		// c.String(http.StatusNotFound, fmt.Sprintf("api: %s not registered!", apiKey))
-		return
+		route, params, allowed := findRoute(c.Request.Method, getAPIRelativePath(c.Request.URL.Path, apiPathPrefix))
+		if route == nil {
+			if len(allowed) > 0 {
+				c.Header("Allow", strings.Join(allowed, ", "))
+				failHandler(c, http.StatusMethodNotAllowed, ErrMethodNotAllowed, "请求方法不支持")
+				return
+			}
+			c.Next()
+			// c.String(http.StatusNotFound, fmt.Sprintf("api: %s not registered!", apiKey))
+			return
+		}
+		apiKey, apiHandlerInfo, pathParams = route.apiKey, apiHandlerFuncMap[route.apiKey], params
+		c.Params = append(c.Params, params...)
 	}
 
+	nameSpan(c, apiKey)
+	defer beginRequestMetrics(c, apiKey)()
+
 	// 处理 CORS
 	if apiHandlerInfo.corsHandler != nil &&
 		apiHandlerInfo.corsHandler.CheckOriginByRequest(c.Request) {
@@ -186,20 +194,45 @@ func handlerApiRequest(c *gin.Context, apiPathPrefix string) {
 		c.PureJSON(200, gin.H{})
 		return
 	}
+
+	// 响应压缩，流式响应和 WebSocket 不压缩
+	compression := compressionConfig(apiHandlerInfo)
+	if apiHandlerInfo.websocket == nil && !isStreamType(apiHandlerInfo.respType) {
+		if cw := compressResponse(c, compression); cw != nil {
+			defer cw.close()
+		}
+	}
+
+	// 限制请求体的大小，需要在读取 body 之前设置
+	if !checkBodySize(c, apiKey, maxBodySize(apiHandlerInfo)) {
+		return
+	}
 	//处理签名校验
 
+	var signed *signInfo
 	if apiHandlerInfo.signCheckHandlerV2 != nil {
 		body := []byte{}
 		var err error
 		if apiHandlerInfo.pt == jsonType {
 			body, err = getBody(c)
+			if errors.Is(err, errBodyTooLarge) {
+				rejectBodyTooLarge(c, apiKey, "body")
+				return
+			}
 			if err != nil {
 				failHandler(c, http.StatusBadRequest, ErrInvalidParam, err.Error())
 				return
 			}
 		}
 
-		if !apiHandlerInfo.signCheckHandlerV2.signCheck(c.Request.URL, c.Request.Header, body) {
+		if checker := apiHandlerInfo.signCheckHandlerV2.hmac; checker != nil {
+			info, signErr := checker.verify(c.Request, body, apiKey, apiHandlerInfo.expire)
+			if signErr != nil {
+				failHandler(c, signErr.HTTPStatus(), signErr.Code(), signErr.Message())
+				return
+			}
+			signed = info
+		} else if !apiHandlerInfo.signCheckHandlerV2.signCheck(c.Request.URL, c.Request.Header, body) {
 			failHandler(c, http.StatusBadRequest, ErrInvalidSignature, "非法签名")
 			return
 		}
@@ -209,10 +242,23 @@ func handlerApiRequest(c *gin.Context, apiPathPrefix string) {
 			return
 		}
 	}
+	// 签名使用压缩的数据计算，校验之后再解压
+	if err := decompressRequestBody(c, compression.maxDecompressedSize()); err != nil {
+		var e *Error
+		if errors.Is(err, errBodyTooLarge) {
+			rejectBodyTooLarge(c, apiKey, "decompressed")
+		} else if errors.As(err, &e) {
+			failHandler(c, e.HTTPStatus(), e.Code(), e.Message())
+		} else {
+			failHandler(c, http.StatusBadRequest, ErrInvalidParam, err.Error())
+		}
+		return
+	}
+
 	//处理数据解密
-	if apiHandlerInfo.cryptoHandler != nil && apiHandlerInfo.cryptoHandler.decryptImpl != nil {
-		if !apiHandlerInfo.cryptoHandler.decryptImpl(c) {
-			failHandler(c, http.StatusBadRequest, ErrCryptoError, "数据加密错误")
+	if apiHandlerInfo.cryptoHandler != nil {
+		if e := apiHandlerInfo.cryptoHandler.decrypt(c); e != nil {
+			failHandler(c, e.HTTPStatus(), e.Code(), e.Message())
 			return
 		}
 	}
@@ -220,10 +266,21 @@ func handlerApiRequest(c *gin.Context, apiPathPrefix string) {
 	reqId, level, er := getReqInfo(c)
 	util.CheckError(er)
 
+	// 客户端断开或者超过接口的超时时间后，ctx 会被取消
+	ctx := c.Request.Context()
+	if apiHandlerInfo.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, apiHandlerInfo.timeout)
+		defer cancel()
+	}
+
 	apiContext := new(ApiContext)
+	apiContext.ctx = ctx
 	apiContext.ClientIP = c.ClientIP()
-	apiContext.Request = c.Request
+	apiContext.Request = c.Request.WithContext(ctx)
 	apiContext.respHeaders = make(map[string]string, 4)
+	apiContext.Keys = make(map[string]interface{}, 4)
+	apiContext.pathParams = pathParams
 
 	// 请求追踪
 	apiContext.ReqId = reqId
@@ -233,37 +290,62 @@ func handlerApiRequest(c *gin.Context, apiPathPrefix string) {
 	// prehandler之前设置
 	apiContext.APIConfig.Expires = apiHandlerInfo.expire
 
+	if signed != nil {
+		apiContext.AppKey = signed.appKey
+		apiContext.Signature = signed.signature
+		apiContext.Nonce = signed.nonce
+		apiContext.Timestamp = signed.timestamp
+	}
+
 	defer func() {
 		s := time.Since(start).Seconds()
 		requestLatency.WithLabelValues(apiKey).Observe(s)
 	}()
 	// 处理请求
-	request := reflect.New(apiHandlerInfo.reqType).Interface()
+	request := apiHandlerInfo.newRequest()
 
-	var err error
-	if apiHandlerInfo.pt == formType {
-		err = c.ShouldBindQuery(request)
-	} else {
-		err = c.ShouldBindBodyWith(request, binding.JSON)
+	fieldTag, err := bindRequest(c, apiHandlerInfo, request, pathParams)
+	if errors.Is(err, errBodyTooLarge) {
+		rejectBodyTooLarge(c, apiKey, "body")
+		return
+	}
+	var bindErr *Error
+	if errors.As(err, &bindErr) {
+		failHandler(c, bindErr.HTTPStatus(), bindErr.Code(), bindErr.Message())
+		return
 	}
-
 	if err != nil {
-		failHandler(c, http.StatusBadRequest, ErrInvalidParam, err.Error())
+		invalidParamHandler(c, apiHandlerInfo.reqType, fieldTag, err)
 		return
 	}
 
-	if len(apiHandlerInfo.preHandlers) != 0 {
-		apiContext.Keys = make(map[string]interface{}, 4)
+	if apiHandlerInfo.upload != nil {
+		if uploadErr := apiHandlerInfo.upload.check(c.Request.MultipartForm); uploadErr != nil {
+			failHandler(c, uploadErr.HTTPStatus(), uploadErr.Code(), uploadErr.Message())
+			return
+		}
+	}
 
-		for _, handler := range apiHandlerInfo.preHandlers {
-			resp := handler(c, apiContext)
-			if resp != nil && resp.Code != 0 {
-				failHandler(c, http.StatusOK, resp.Code, resp.Message)
-				return
+	for _, handler := range apiHandlerInfo.preHandlers {
+		resp := handler(c, apiContext)
+		if resp != nil && resp.Code != 0 {
+			status := resp.status
+			if status == 0 {
+				status = http.StatusOK
 			}
+			preHandlerRejectedCounter.WithLabelValues(apiKey, strconv.Itoa(resp.Code)).Inc()
+			failHandlerWithData(c, status, resp.Code, resp.Message, resp.Data)
+			return
 		}
 	}
 
+	// 限流放在 preHandlers 之后，preHandlers 中可以设置 AppKey、DeviceID 等限流维度
+	if apiHandlerInfo.rateLimiter != nil && !apiHandlerInfo.rateLimiter.allow(c, apiContext, apiKey) {
+		rateLimitedCounter.WithLabelValues(apiKey).Inc()
+		failHandler(c, http.StatusTooManyRequests, ErrTooManyRequests, "请求过于频繁")
+		return
+	}
+
 	if c.IsAborted() {
 		log.GetLogger("access_error").Info("request is aborted",
 			zap.String("url", c.Request.URL.String()),
@@ -273,70 +355,189 @@ func handlerApiRequest(c *gin.Context, apiPathPrefix string) {
 		return
 	}
 
-	handler := reflect.New(apiHandlerInfo.handler).Interface()
-	// 设置请求且信息
-	reflect.ValueOf(handler).Elem().FieldByName("Request").Set(reflect.ValueOf(request).Elem())
+	if apiHandlerInfo.websocket != nil {
+		// 连接关闭后再记录日志
+		response, err := serveWebSocket(c, apiHandlerInfo, apiContext)
+		log.GetLogger("access").Info("api", zap.String("reqId", reqId), zap.String("traceId", tracing.TraceID(apiContext)), zap.String("api", apiKey), zap.Int("useTime(ms)", int(time.Since(start).Milliseconds())), zap.Any("request", request), zap.Any("context", apiContext), zap.Any("Response", response), zap.Error(err))
+		return
+	}
+
+	// 流式响应不支持缓存和幂等，加密的响应每个调用方不同，不缓存
+	if apiHandlerInfo.cache != nil && apiHandlerInfo.cryptoHandler == nil && !isStreamType(apiHandlerInfo.respType) && c.GetHeader("Mock") != "true" {
+		cached, done := apiHandlerInfo.cache.begin(c, apiContext, apiKey, request, apiHandlerInfo.cacheTags)
+		if done {
+			return
+		}
+		if cached != nil {
+			defer cached.finish(c)
+		}
+	}
+	if apiHandlerInfo.evictTags != nil {
+		defer evictCacheTags(c, apiContext, request, apiHandlerInfo.evictTags)
+	}
+
+	if apiHandlerInfo.idempotency != nil && !isStreamType(apiHandlerInfo.respType) {
+		idem, done := apiHandlerInfo.idempotency.begin(c, apiContext, apiKey)
+		if done {
+			return
+		}
+		if idem != nil {
+			defer idem.finish(c)
+		}
+	}
 
 	if c.GetHeader("Mock") == "true" {
-		ret := reflect.ValueOf(handler).Elem().MethodByName("Mock").Call([]reflect.Value{})
-		c.PureJSON(200, ret[0].Interface())
+		c.PureJSON(200, apiHandlerInfo.mock(request))
 	} else {
-		ret := reflect.ValueOf(handler).Elem().MethodByName("Handler").Call([]reflect.Value{reflect.ValueOf(apiContext)})
 		var response interface{}
-		if ret[1].IsNil() {
-			response = ret[0].Interface()
-			// 正常响应,返回数据加密
-			if apiHandlerInfo.cryptoHandler != nil && apiHandlerInfo.cryptoHandler.encryptImpl != nil {
+		if apiHandlerInfo.timeout > 0 {
+			response, err = callHandlerWithTimeout(apiHandlerInfo, apiKey, apiContext, request)
+		} else {
+			response, err = apiHandlerInfo.call(apiContext, request)
+		}
+
+		if err != nil && apiContext.Err() == context.DeadlineExceeded {
+			failHandler(c, http.StatusGatewayTimeout, ErrRequestTimeout, "请求处理超时")
+			return
+		}
+
+		status := http.StatusOK
+		respType := apiHandlerInfo.respType
+		if err == nil {
+			// 正常响应,返回数据加密，流式响应不加密
+			if apiHandlerInfo.cryptoHandler != nil && apiHandlerInfo.cryptoHandler.encryptImpl != nil && !isStreamType(respType) {
 				response = apiHandlerInfo.cryptoHandler.encryptImpl(c, response)
 			}
 		} else {
-			err = ret[1].Interface().(error)
-			response = Resp{Code: ErrLogicError, Message: err.Error()}
+			status, response = errorResp(err)
+			// 二进制类型的响应无法表示错误，统一返回 json
+			if respType != XmlType && respType != StringType {
+				respType = JsonType
+			}
 		}
 
-		// access 日志处理
-		//log.GetLogger("access").Info("api", zap.String("reqId", reqId), zap.String("api", apiKey), zap.Any("request", request), zap.Any("context", apiContext), zap.Any("Response", response))
+		setResultCode(c, resultCode(response))
 
 		// 写入 Header
 		for key, val := range apiContext.respHeaders {
 			c.Header(key, val)
 		}
 
-		switch apiHandlerInfo.respType {
+		switch respType {
 		case XmlType:
-			c.XML(200, response)
+			c.XML(status, response)
 		case StringType:
-			c.String(200, "%v", response)
+			c.String(status, "%v", response)
 		case TextHtmlType:
 			respData, ok := response.([]byte)
 			if !ok {
 				panic("content-type is text/html,resp type must be []byte")
 			}
-			c.Data(200, "text/html; charset=utf-8", respData)
+			c.Data(status, "text/html; charset=utf-8", respData)
 		case OctetStreamType:
 			respData, ok := response.([]byte)
 			if !ok {
 				panic("content-type is application/octet-stream,resp type must be []byte")
 			}
-			c.Data(200, "application/octet-stream; charset=utf-8", respData)
+			c.Data(status, "application/octet-stream; charset=utf-8", respData)
 		case JsonStreamType:
 			respData, ok := response.([]byte)
 			if !ok {
 				panic("content-type is application/json,resp type must be []byte")
 			}
-			c.Data(200, "application/json; charset=utf-8", respData)
+			c.Data(status, "application/json; charset=utf-8", respData)
+		case SSEType, NDJSONType:
+			// 流式响应结束后再记录日志，日志中只记录事件的数量
+			count, streamErr := writeStream(apiContext, c, respType, apiHandlerInfo.heartbeat, response)
+			response = fmt.Sprintf("stream: %d events", count)
+			if isClientGone(streamErr) {
+				response = fmt.Sprintf("stream: %d events, client closed", count)
+			} else if streamErr != nil {
+				err = streamErr
+			}
 		default:
-			c.PureJSON(200, response) // 默认是json，但是如果返回的是二进制的json串，此方法会编码成base64格式
+			writeResponse(c, status, response, err != nil)
 
 		}
 		// access 日志处理
 		realResp := getRealResp(response)
-		log.GetLogger("access").Info("api", zap.String("reqId", reqId), zap.String("api", apiKey), zap.Int("useTime(ms)", int(time.Since(start).Milliseconds())), zap.Any("request", request), zap.Any("context", apiContext), zap.Any("Response", realResp))
+		log.GetLogger("access").Info("api", zap.String("reqId", reqId), zap.String("traceId", tracing.TraceID(apiContext)), zap.String("api", apiKey), zap.Int("useTime(ms)", int(time.Since(start).Milliseconds())), zap.Any("request", request), zap.Any("context", apiContext), zap.Any("Response", realResp), zap.Error(err))
 
 	}
 }
 
+type handlerResult struct {
+	response  interface{}
+	err       error
+	recovered interface{}
+}
+
+// callHandlerWithTimeout 在单独的 goroutine 中调用业务 Handler，ApiContext 被取消后不再等待 Handler 返回。
+// 超时后 goroutine 不会被中止，Handler 需要处理 ApiContext.Done()，超时之后才返回的 Handler 记录在 api_handler_overrun 中
+func callHandlerWithTimeout(handlerInfo *HandlerInfo, apiKey string, apiContext *ApiContext, request interface{}) (interface{}, error) {
+	const (
+		handlerRunning int32 = iota
+		handlerReturned
+		handlerAbandoned
+	)
+	var state int32
+	start := time.Now()
+	ch := make(chan handlerResult, 1)
+
+	go func() {
+		var result handlerResult
+		defer func() {
+			if err := recover(); err != nil {
+				log.GetLogger("error").Sugar().Errorf("[Recovery] %s, %s\n %s", err, apiContext.Request.URL.Path, recovery.Stack(3))
+				result = handlerResult{recovered: err}
+			}
+			if !atomic.CompareAndSwapInt32(&state, handlerRunning, handlerReturned) {
+				handlerOverrunCounter.WithLabelValues(apiKey).Inc()
+				log.Default().Warn("handler returned after timeout", zap.String("api", apiKey), zap.String("reqId", apiContext.ReqId), zap.Duration("elapsed", time.Since(start)))
+			}
+			ch <- result
+		}()
+
+		result.response, result.err = handlerInfo.call(apiContext, request)
+	}()
+
+	var result handlerResult
+	select {
+	case result = <-ch:
+	case <-apiContext.Done():
+		if atomic.CompareAndSwapInt32(&state, handlerRunning, handlerAbandoned) {
+			return nil, apiContext.Err()
+		}
+		// Handler 同时返回
+		result = <-ch
+	}
+	if result.recovered != nil {
+		// 交给 handlerApiRequest 统一处理
+		panic(result.recovered)
+	}
+	return result.response, result.err
+}
+
+// invalidParamHandler 请求参数绑定失败，返回字段级别的错误信息
+func invalidParamHandler(c *gin.Context, reqType reflect.Type, fieldTag string, err error) {
+	fields := bindingFieldErrors(c, reqType, fieldTag, err)
+	if len(fields) == 0 {
+		failHandler(c, http.StatusBadRequest, ErrInvalidParam, err.Error())
+		return
+	}
+
+	messages := make([]string, 0, len(fields))
+	for _, field := range fields {
+		messages = append(messages, field.Message)
+	}
+	failHandlerWithData(c, http.StatusBadRequest, ErrInvalidParam, strings.Join(messages, "; "), fields)
+}
+
 func failHandler(c *gin.Context, status int, code int, message string) {
+	failHandlerWithData(c, status, code, message, nil)
+}
+
+func failHandlerWithData(c *gin.Context, status int, code int, message string, data interface{}) {
 
 	ua := c.Request.UserAgent()
 
@@ -348,14 +549,21 @@ func failHandler(c *gin.Context, status int, code int, message string) {
 		sb.WriteString("\n")
 		sb.WriteString(message)
 		sb.WriteString("\n")
+		if data != nil {
+			d, _ := json.MarshalIndent(data, "", "  ")
+			sb.WriteString("\n")
+			sb.Write(d)
+			sb.WriteString("\n")
+		}
 
 		c.Data(status, "text/plain charset=utf-8", []byte(sb.String()))
 		c.Abort()
 	} else {
-		c.AbortWithStatusJSON(status, Resp{Code: code, Message: message})
+		c.AbortWithStatusJSON(status, Resp{Code: code, Message: message, Data: data})
 
 	}
-	invalidRequestCounter.WithLabelValues(c.Request.URL.Path, strconv.Itoa(code)).Inc()
+	setResultCode(c, code)
+	invalidRequestCounter.WithLabelValues(metricsAPI(c), strconv.Itoa(code)).Inc()
 
 	body, _ := c.Get(gin.BodyBytesKey)
 	log.GetLogger("access_error").Info(c.Request.URL.Path,
@@ -369,14 +577,15 @@ func failHandler(c *gin.Context, status int, code int, message string) {
 }
 
 func getAPIKey(path string, apiPathPrefix string) string {
+	return strings.ReplaceAll(getAPIRelativePath(path, apiPathPrefix), "/", ".")
+}
+
+// getAPIRelativePath 去掉接口前缀后的路径，不以 / 开头
+func getAPIRelativePath(path string, apiPathPrefix string) string {
 	if apiPathPrefix != kAnyApiPathPrefixAllowed {
 		path = path[len(apiPathPrefix):]
 	}
-	if strings.HasPrefix(path, "/") {
-		return strings.ReplaceAll(path[1:], "/", ".")
-	} else {
-		return strings.ReplaceAll(path, "/", ".")
-	}
+	return strings.TrimPrefix(path, "/")
 }
 
 // getRealResp 简单的处理下返回的长度，响应数据量太大，日志过大刷屏
@@ -0,0 +1,135 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+
+	"github.com/xbonlinenet/goup/frame/log"
+	"github.com/xbonlinenet/goup/frame/perf"
+)
+
+var initTestLoggerOnce sync.Once
+
+// newTestAPIEngine 经过 APIMiddleware 处理请求，网关使用的日志输出到标准输出
+func newTestAPIEngine() *gin.Engine {
+	initTestLoggerOnce.Do(func() {
+		viper.Set("application.forceLog2Stdout", true)
+		viper.Set("log", map[string]interface{}{
+			"access":       map[string]interface{}{"level": "error", "interval": "24h"},
+			"access_error": map[string]interface{}{"level": "error", "interval": "24h"},
+			"error":        map[string]interface{}{"level": "error", "interval": "24h"},
+		})
+		if err := log.Init(); err != nil {
+			panic(err)
+		}
+	})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(perf.ReqIdKey, "req-1")
+		c.Set(perf.ReqLevel, 1)
+	}, APIMiddleware("/api/"))
+	return r
+}
+
+func TestApiContext(t *testing.T) {
+	type ctxKey struct{}
+
+	var empty ApiContext
+	if _, ok := empty.Deadline(); ok || empty.Done() != nil || empty.Err() != nil {
+		t.Fatal("ApiContext without ctx should behave like context.Background()")
+	}
+
+	parent, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxKey{}, "parent"), time.Minute)
+	c := &ApiContext{ctx: parent, Keys: map[string]interface{}{"user": "keys"}}
+
+	if deadline, ok := c.Deadline(); !ok || time.Until(deadline) <= 0 {
+		t.Errorf("Deadline() = %v, %v", deadline, ok)
+	}
+	if c.Value(ctxKey{}) != "parent" || c.Value("user") != "keys" {
+		t.Errorf("Value() should read Keys and the request context")
+	}
+
+	cancel()
+	select {
+	case <-c.Done():
+	default:
+		t.Fatal("Done() should be closed after cancel")
+	}
+	if c.Err() != context.Canceled {
+		t.Errorf("Err() = %v", c.Err())
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	cancelled := make(chan error, 1)
+	Register("timeout", "slow", "slow api", func(c *ApiContext, req *registerRequest) (*registerResponse, error) {
+		<-c.Done()
+		cancelled <- c.Err()
+		return nil, c.Err()
+	}, Timeout(50*time.Millisecond))
+
+	overrun := make(chan struct{})
+	Register("timeout", "overrun", "overrun api", func(c *ApiContext, req *registerRequest) (*registerResponse, error) {
+		<-overrun
+		return &registerResponse{}, nil
+	}, Timeout(50*time.Millisecond))
+
+	Register("timeout", "fast", "fast api", func(c *ApiContext, req *registerRequest) (*registerResponse, error) {
+		return &registerResponse{Message: req.Message}, nil
+	}, Timeout(time.Second))
+
+	r := newTestAPIEngine()
+	serve := func(api string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/timeout/"+api, bytes.NewBufferString(`{"message":"hello"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	var resp Resp
+	w := serve("slow")
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusGatewayTimeout || resp.Code != ErrRequestTimeout {
+		t.Fatalf("timeout response = %d %s", w.Code, w.Body.String())
+	}
+	select {
+	case err := <-cancelled:
+		if err != context.DeadlineExceeded {
+			t.Errorf("handler ctx error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler ctx should be cancelled")
+	}
+
+	if w := serve("fast"); w.Code != http.StatusOK {
+		t.Fatalf("fast response = %d %s", w.Code, w.Body.String())
+	}
+
+	// Handler 没有处理 ctx，超时之后返回记录在指标中
+	before := testutil.ToFloat64(handlerOverrunCounter.WithLabelValues("timeout.overrun"))
+	if w := serve("overrun"); w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("overrun response = %d %s", w.Code, w.Body.String())
+	}
+	close(overrun)
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(handlerOverrunCounter.WithLabelValues("timeout.overrun")) != before+1 {
+		if time.Now().After(deadline) {
+			t.Fatal("overrun handler should be counted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,497 @@
+package gateway
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+
+	"github.com/xbonlinenet/goup/frame/util"
+)
+
+const openAPIVersion = "3.0.3"
+
+// OpenAPI OpenAPI 3 文档根对象
+type OpenAPI struct {
+	OpenAPI    string              `json:"openapi" yaml:"openapi"`
+	Info       OpenAPIInfo         `json:"info" yaml:"info"`
+	Tags       []*OpenAPITag       `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Paths      map[string]PathItem `json:"paths" yaml:"paths"`
+	Components OpenAPIComponents   `json:"components" yaml:"components"`
+	// ErrorCodes 服务定义的错误码
+	ErrorCodes []*ErrorCode `json:"x-error-codes,omitempty" yaml:"x-error-codes,omitempty"`
+}
+
+// OpenAPIInfo 服务基本信息
+type OpenAPIInfo struct {
+	Title       string `json:"title" yaml:"title"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Version     string `json:"version" yaml:"version"`
+}
+
+// OpenAPITag 接口分组
+type OpenAPITag struct {
+	Name string `json:"name" yaml:"name"`
+}
+
+// OpenAPIComponents 可复用的结构定义
+type OpenAPIComponents struct {
+	Schemas map[string]*Schema `json:"schemas" yaml:"schemas"`
+}
+
+// PathItem 同一个路径下不同 HTTP 方法的接口定义, key 为小写的方法名
+type PathItem map[string]*Operation
+
+// Operation 单个接口定义
+type Operation struct {
+	Tags        []string             `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Summary     string               `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Description string               `json:"description,omitempty" yaml:"description,omitempty"`
+	OperationID string               `json:"operationId" yaml:"operationId"`
+	Parameters  []*Parameter         `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty" yaml:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses" yaml:"responses"`
+}
+
+// Parameter query/header/path 参数
+type Parameter struct {
+	Name        string  `json:"name" yaml:"name"`
+	In          string  `json:"in" yaml:"in"`
+	Description string  `json:"description,omitempty" yaml:"description,omitempty"`
+	Required    bool    `json:"required,omitempty" yaml:"required,omitempty"`
+	Schema      *Schema `json:"schema" yaml:"schema"`
+}
+
+// RequestBody 请求体
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty" yaml:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content" yaml:"content"`
+}
+
+// Response 响应定义
+type Response struct {
+	Description string                `json:"description" yaml:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty" yaml:"content,omitempty"`
+}
+
+// MediaType 某种 Content-Type 下的结构
+type MediaType struct {
+	Schema *Schema `json:"schema" yaml:"schema"`
+}
+
+// Schema JSON Schema 子集
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty" yaml:"type,omitempty"`
+	Format               string             `json:"format,omitempty" yaml:"format,omitempty"`
+	Description          string             `json:"description,omitempty" yaml:"description,omitempty"`
+	Items                *Schema            `json:"items,omitempty" yaml:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty" yaml:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty" yaml:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty" yaml:"required,omitempty"`
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	respStructType = reflect.TypeOf(Resp{})
+
+	invalidSchemaNameChar = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// OpenAPISpec 根据已注册的接口生成 OpenAPI 3 文档
+func OpenAPISpec() *OpenAPI {
+	builder := &schemaBuilder{schemas: map[string]*Schema{}}
+
+	spec := &OpenAPI{
+		OpenAPI: openAPIVersion,
+		Info: OpenAPIInfo{
+			Title:   viper.GetString("application.name"),
+			Version: util.Version,
+		},
+		Paths:      map[string]PathItem{},
+		ErrorCodes: ErrorCodes(),
+	}
+
+	groups := map[string]bool{}
+	for _, api := range apis {
+		apiKey := api.Group + "." + api.Key
+		info, ok := apiHandlerFuncMap[apiKey]
+		if !ok {
+			continue
+		}
+
+		if !groups[api.Group] {
+			groups[api.Group] = true
+			spec.Tags = append(spec.Tags, &OpenAPITag{Name: api.Group})
+		}
+
+		path := getAPIPath(api, nil)
+		item, ok := spec.Paths[path]
+		if !ok {
+			item = PathItem{}
+			spec.Paths[path] = item
+		}
+
+		method, op := builder.operation(api, info)
+		item[method] = op
+	}
+
+	spec.Components.Schemas = builder.schemas
+	return spec
+}
+
+// OpenAPIJSON 输出 json 格式的 OpenAPI 文档
+func OpenAPIJSON(c *gin.Context) {
+	c.PureJSON(http.StatusOK, OpenAPISpec())
+}
+
+// OpenAPIYAML 输出 yaml 格式的 OpenAPI 文档
+func OpenAPIYAML(c *gin.Context) {
+	data, err := yaml.Marshal(OpenAPISpec())
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "application/yaml; charset=utf-8", data)
+}
+
+// getAPIPath 接口对外暴露的请求路径，RESTful 接口的路径参数为 {name} 的形式，request 不为空时使用其中的路径参数
+func getAPIPath(api *API, request interface{}) string {
+	prefix := apiPathPrefix
+	if prefix == kAnyApiPathPrefixAllowed {
+		prefix = "/"
+	}
+	if info, ok := apiHandlerFuncMap[api.Group+"."+api.Key]; ok && info.route != nil {
+		return strings.TrimSuffix(prefix, "/") + info.route.routePath(request)
+	}
+	return prefix + api.Group + "/" + strings.ReplaceAll(api.Key, ".", "/")
+}
+
+type schemaBuilder struct {
+	schemas map[string]*Schema
+}
+
+func (b *schemaBuilder) operation(api *API, info *HandlerInfo) (string, *Operation) {
+	op := &Operation{
+		Tags:        []string{api.Group},
+		Summary:     api.Name,
+		Description: operationDescription(api, info),
+		OperationID: api.Group + "." + api.Key,
+		Responses:   map[string]*Response{},
+	}
+
+	method := "post"
+	if info.pt == formType {
+		method = "get"
+	}
+	if info.route != nil {
+		method = strings.ToLower(info.route.method)
+		op.Parameters = b.sourceParameters(info.reqType, sourcePath)
+	}
+	op.Parameters = append(op.Parameters, b.sourceParameters(info.reqType, sourceHeader)...)
+	op.Parameters = append(op.Parameters, b.sourceParameters(info.reqType, sourceCookie)...)
+	op.Parameters = append(op.Parameters, b.queryParameters(info.reqType, info.pt == formType)...)
+
+	if info.pt != formType && info.sources != nil && info.sources.files {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]*MediaType{
+				"multipart/form-data": {Schema: b.multipartSchema(info.reqType)},
+			},
+		}
+	} else if info.pt != formType {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]*MediaType{
+				"application/json": {Schema: b.schemaOf(info.reqType)},
+			},
+		}
+	}
+
+	op.Responses["200"] = b.successResponse(api, info)
+	op.Responses["400"] = &Response{
+		Description: "请求参数错误",
+		Content: map[string]*MediaType{
+			"application/json": {Schema: b.schemaOf(respStructType)},
+		},
+	}
+
+	return method, op
+}
+
+func operationDescription(api *API, info *HandlerInfo) string {
+	lines := make([]string, 0, len(info.extInfo)+1)
+	if api.Summary != "" {
+		lines = append(lines, api.Summary)
+	}
+
+	keys := make([]string, 0, len(info.extInfo))
+	for k := range info.extInfo {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		lines = append(lines, k+": "+info.extInfo[k])
+	}
+	return strings.Join(lines, "\n\n")
+}
+
+func (b *schemaBuilder) successResponse(api *API, info *HandlerInfo) *Response {
+	var contentType string
+	var schema *Schema
+
+	switch info.respType {
+	case XmlType:
+		contentType, schema = "application/xml", b.schemaOf(api.RespType)
+	case StringType:
+		contentType, schema = "text/plain", &Schema{Type: "string"}
+	case TextHtmlType:
+		contentType, schema = "text/html", &Schema{Type: "string"}
+	case OctetStreamType:
+		contentType, schema = "application/octet-stream", &Schema{Type: "string", Format: "binary"}
+	case SSEType:
+		// schema 为单个事件的 data
+		contentType, schema = "text/event-stream", b.schemaOf(api.RespType)
+	case NDJSONType:
+		contentType, schema = "application/x-ndjson", b.schemaOf(api.RespType)
+	default:
+		contentType, schema = "application/json", b.schemaOf(api.RespType)
+	}
+
+	return &Response{
+		Description: "OK",
+		Content: map[string]*MediaType{
+			contentType: {Schema: schema},
+		},
+	}
+}
+
+// queryParameters query 参数, 按 gin form 绑定的规则展开。
+// FormParam 接口 all 为 true, 除 path、header 等以外的字段都从 query 中读取; json 接口只有 form tag 的字段从 query 中读取
+func (b *schemaBuilder) queryParameters(t reflect.Type, all bool) []*Parameter {
+	params := make([]*Parameter, 0)
+	walkFields(t, func(field reflect.StructField) {
+		source := fieldSource(field)
+		if source != sourceQuery && !(all && source == sourceBody) {
+			return
+		}
+		name := strings.Split(field.Tag.Get("form"), ",")[0]
+		if name == "-" {
+			return
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := b.schemaOf(field.Type)
+		schema.Description = field.Tag.Get("desc")
+		params = append(params, &Parameter{
+			Name:        name,
+			In:          "query",
+			Description: field.Tag.Get("desc"),
+			Required:    isRequiredField(field),
+			Schema:      schema,
+		})
+	})
+	return params
+}
+
+// multipartSchema 上传文件接口的表单，文件字段为 binary
+func (b *schemaBuilder) multipartSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	walkFields(t, func(field reflect.StructField) {
+		source := fieldSource(field)
+		if source != sourceBody && source != sourceQuery && source != sourceFile {
+			return
+		}
+		name := tagName(field, "form")
+		if name == "-" {
+			return
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		var prop *Schema
+		switch {
+		case field.Type == fileHeaderType:
+			prop = &Schema{Type: "string", Format: "binary"}
+		case isFileType(field.Type):
+			prop = &Schema{Type: "array", Items: &Schema{Type: "string", Format: "binary"}}
+		default:
+			prop = b.schemaOf(field.Type)
+		}
+		if prop.Ref == "" {
+			prop.Description = field.Tag.Get("desc")
+		}
+		schema.Properties[name] = prop
+
+		if isRequiredField(field) {
+			schema.Required = append(schema.Required, name)
+		}
+	})
+	return schema
+}
+
+// sourceParameters path、header、cookie 参数
+func (b *schemaBuilder) sourceParameters(t reflect.Type, source string) []*Parameter {
+	params := make([]*Parameter, 0)
+	walkFields(t, func(field reflect.StructField) {
+		if fieldSource(field) != source {
+			return
+		}
+		name := tagName(field, source)
+		// 路径参数总是必须的
+		required := source == sourcePath || isRequiredField(field)
+
+		schema := b.schemaOf(field.Type)
+		schema.Description = field.Tag.Get("desc")
+		params = append(params, &Parameter{
+			Name:        name,
+			In:          source,
+			Description: field.Tag.Get("desc"),
+			Required:    required,
+			Schema:      schema,
+		})
+	})
+	return params
+}
+
+// schemaOf 生成类型对应的 Schema, 具名结构体会放入 components 中并返回引用
+func (b *schemaBuilder) schemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schemaOf(t.Elem())}
+	case reflect.Chan:
+		return b.schemaOf(t.Elem())
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+
+		name := schemaName(t)
+		if _, ok := b.schemas[name]; !ok {
+			// 先占位, 避免自引用的结构体无限递归
+			b.schemas[name] = &Schema{}
+			*b.schemas[name] = *b.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	default:
+		// interface{} 等任意类型
+		return &Schema{}
+	}
+}
+
+func (b *schemaBuilder) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	walkFields(t, func(field reflect.StructField) {
+		name := dtoFieldName(field)
+		// path、header 等参数不在 body 中
+		if name == "-" {
+			return
+		}
+		switch fieldSource(field) {
+		case sourcePath, sourceHeader, sourceCookie:
+			return
+		}
+
+		prop := b.schemaOf(field.Type)
+		// $ref 的兄弟节点会被忽略, 引用类型不设置描述
+		if prop.Ref == "" {
+			prop.Description = field.Tag.Get("desc")
+		}
+		schema.Properties[name] = prop
+
+		if isRequiredField(field) {
+			schema.Required = append(schema.Required, name)
+		}
+	})
+	return schema
+}
+
+// walkFields 遍历结构体的导出字段, 匿名嵌入的结构体会被展开
+func walkFields(t reflect.Type, fn func(field reflect.StructField)) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if field.Anonymous {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+				walkFields(ft, fn)
+				continue
+			}
+		}
+
+		if field.PkgPath != "" {
+			// 未导出字段
+			continue
+		}
+		fn(field)
+	}
+}
+
+// dtoFieldName 字段在 json 中的名称, 与 getDTOFieldInfo 保持一致
+func dtoFieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		name = strings.Split(field.Tag.Get("form"), ",")[0]
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return name
+}
+
+func isRequiredField(field reflect.StructField) bool {
+	for _, rule := range strings.Split(field.Tag.Get("binding"), ",") {
+		if rule == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+func schemaName(t reflect.Type) string {
+	return invalidSchemaNameChar.ReplaceAllString(t.String(), "_")
+}
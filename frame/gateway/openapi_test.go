@@ -0,0 +1,94 @@
+package gateway
+
+import (
+	"testing"
+)
+
+type openAPIItem struct {
+	Name string `json:"name" desc:"item name" binding:"required"`
+}
+
+type openAPIRequest struct {
+	Message string         `json:"message" desc:"message" binding:"required"`
+	Items   []*openAPIItem `json:"items" desc:"items"`
+	Ignored string         `json:"-"`
+}
+
+type openAPIResponse struct {
+	Code int            `json:"code"`
+	Item *openAPIItem   `json:"item"`
+	Tags map[string]int `json:"tags"`
+}
+
+type openAPIHandler struct {
+	Request  openAPIRequest
+	Response openAPIResponse
+}
+
+func (h openAPIHandler) Handler(c *ApiContext) (interface{}, error) {
+	return nil, nil
+}
+
+type openAPIFormRequest struct {
+	Page int `form:"page" desc:"page index" binding:"required"`
+	Size int `form:"size"`
+}
+
+type openAPIFormHandler struct {
+	Request  openAPIFormRequest
+	Response openAPIResponse
+}
+
+func (h openAPIFormHandler) Handler(c *ApiContext) (interface{}, error) {
+	return nil, nil
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	RegisterAPI("openapi", "json", "json api", openAPIHandler{})
+	RegisterAPI("openapi", "form", "form api", openAPIFormHandler{}, FormParam(), ResponseXML())
+
+	spec := OpenAPISpec()
+
+	op := spec.Paths["/api/openapi/json"]["post"]
+	if op == nil {
+		t.Fatalf("json api not found in paths")
+	}
+	ref := op.RequestBody.Content["application/json"].Schema.Ref
+	if ref != "#/components/schemas/gateway.openAPIRequest" {
+		t.Errorf("request schema ref = %s", ref)
+	}
+
+	req := spec.Components.Schemas["gateway.openAPIRequest"]
+	if req == nil {
+		t.Fatalf("request schema not generated")
+	}
+	if len(req.Required) != 1 || req.Required[0] != "message" {
+		t.Errorf("required = %v", req.Required)
+	}
+	if _, ok := req.Properties["Ignored"]; ok {
+		t.Errorf("json:\"-\" field should be skipped")
+	}
+	if req.Properties["message"].Description != "message" {
+		t.Errorf("description = %s", req.Properties["message"].Description)
+	}
+	if items := req.Properties["items"]; items.Type != "array" || items.Items.Ref != "#/components/schemas/gateway.openAPIItem" {
+		t.Errorf("items schema = %+v", items)
+	}
+	if _, ok := spec.Components.Schemas["gateway.openAPIItem"]; !ok {
+		t.Errorf("nested schema not generated")
+	}
+
+	form := spec.Paths["/api/openapi/form"]["get"]
+	if form == nil {
+		t.Fatalf("form api not found in paths")
+	}
+	if form.RequestBody != nil || len(form.Parameters) != 2 {
+		t.Errorf("form api should use query parameters")
+	}
+	if p := form.Parameters[0]; p.Name != "page" || p.In != "query" || !p.Required {
+		t.Errorf("parameter = %+v", p)
+	}
+	if _, ok := form.Responses["200"].Content["application/xml"]; !ok {
+		t.Errorf("xml response content type not set")
+	}
+}
@@ -23,6 +23,16 @@ func Expired(duration time.Duration) Option {
 	})
 }
 
+// Timeout 接口处理的超时时间，超时后 ApiContext 会被取消，客户端收到 504 和 ErrRequestTimeout。
+//
+// 网关不会中止超时的 Handler，Handler 需要处理 ApiContext.Done()（或者把 ApiContext 传给 DB、Redis、RPC 调用），
+// 否则返回超时之后 Handler 仍会继续执行，次数记录在 api_handler_overrun 指标中
+func Timeout(duration time.Duration) Option {
+	return optionFunc(func(handler *HandlerInfo) {
+		handler.timeout = duration
+	})
+}
+
 // HandlerFunc 设置 PreHandler，可用于统一登录鉴权使用
 func HandlerFunc(handlerFunc PreHandler) Option {
 	return optionFunc(func(handler *HandlerInfo) {
@@ -55,6 +65,15 @@ func RespContentType(contentType respType) Option {
 	})
 }
 
+// MockResponse 请求头 Mock: true 时返回的数据，用于 Register 注册的接口
+func MockResponse(data interface{}) Option {
+	return optionFunc(func(handler *HandlerInfo) {
+		handler.mock = func(interface{}) interface{} {
+			return data
+		}
+	})
+}
+
 // ExtInfo 设置额外的说明信息
 func ExtInfo(info map[string]string) Option {
 	return optionFunc(func(handler *HandlerInfo) {
@@ -1,18 +1,22 @@
 package gateway
 
 import (
+	"net/http"
 	"reflect"
 	"runtime"
 	"strconv"
-	"time"
 
-	"github.com/Shopify/sarama"
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
 	uuid "github.com/satori/go.uuid"
-	"github.com/xbonlinenet/goup/frame/data"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/xbonlinenet/goup/frame/log"
 	"github.com/xbonlinenet/goup/frame/perf"
+	"github.com/xbonlinenet/goup/frame/tracing"
 	"github.com/xbonlinenet/goup/frame/util"
 )
 
@@ -52,27 +56,12 @@ func getReqInfo(c *gin.Context) (string, int, error) {
 
 }
 
+// WrapFunc 在 ctx 的 Span 下为 foo 创建子 Span，Span 的名称为函数名
 func WrapFunc(ctx *ApiContext, foo func()) {
 	funcName := runtime.FuncForPC(reflect.ValueOf(foo).Pointer()).Name()
 
-	startPoint := perf.Point{
-		ReqId:    ctx.ReqId,
-		Server:   util.GetServerName(),
-		Host:     util.GetHost(),
-		ActionAt: time.Now(),
-		Level:    ctx.ReqLevel,
-		Name:     funcName,
-		Action:   1,
-	}
-
-	recoredPoint(&startPoint)
-
-	defer func() {
-		endPoint := startPoint
-		endPoint.ActionAt = time.Now()
-		endPoint.Action = 2
-		recoredPoint(&endPoint)
-	}()
+	_, span := tracing.Start(ctx, funcName)
+	defer span.End()
 
 	foo()
 }
@@ -94,45 +83,34 @@ func wrapRequest(foo func(c *gin.Context, prefix string), c *gin.Context, apiPat
 	c.Keys[perf.ReqIdKey] = reqId
 	c.Keys[perf.ReqLevel] = reqLevel
 
-	funcName := c.Request.URL.Path
-
-	startPoint := perf.Point{
-		ReqId:    reqId,
-		Server:   util.GetServerName(),
-		Host:     util.GetHost(),
-		ActionAt: time.Now(),
-		Level:    reqLevel,
-		Name:     funcName,
-		Action:   1,
-	}
-
-	recoredPoint(&startPoint)
+	// 上游通过 traceparent 传递 Span，和 reqId 同时使用
+	ctx := tracing.ExtractHTTP(c.Request.Context(), c.Request.Header)
+	ctx, span := tracing.Start(ctx, c.Request.URL.Path,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(c.Request.Method),
+			semconv.HTTPTargetKey.String(c.Request.URL.Path),
+			semconv.HTTPClientIPKey.String(c.ClientIP()),
+			attribute.String("goup.req_id", reqId),
+			attribute.Int("goup.req_level", reqLevel),
+		))
+	c.Request = c.Request.WithContext(ctx)
 
 	defer func() {
-		endPoint := startPoint
-		endPoint.ActionAt = time.Now()
-		endPoint.Action = 2
-		recoredPoint(&endPoint)
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		span.End()
 	}()
 
 	foo(c, apiPathPrefix)
 }
 
-func recoredPoint(point *perf.Point) {
-
-	// fmt.Printf("%v\n", point)
-
-	if true {
-		return
-	}
-
-	producer := data.MustGetAsyncProducer()
-
-	data, err := json.Marshal(point)
-	util.CheckError(err)
-	producer.Input() <- &sarama.ProducerMessage{
-		Topic: perf.TraceKafkaTopic,
-		Key:   sarama.StringEncoder(point.ReqId),
-		Value: sarama.ByteEncoder(data),
-	}
+// nameSpan 找到接口后使用接口名作为 Span 的名称
+func nameSpan(c *gin.Context, apiKey string) {
+	span := trace.SpanFromContext(c.Request.Context())
+	span.SetName(apiKey)
+	span.SetAttributes(attribute.String("goup.api", apiKey))
 }
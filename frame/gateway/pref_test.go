@@ -0,0 +1,52 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/xbonlinenet/goup/frame/tracing"
+)
+
+func TestWrapRequestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/demo/echo", nil)
+	c.Request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	var traceId string
+	wrapRequest(func(c *gin.Context, prefix string) {
+		traceId = tracing.TraceID(c.Request.Context())
+		nameSpan(c, "demo.echo")
+		c.Status(http.StatusInternalServerError)
+	}, c, "/api/")
+
+	if traceId != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("upstream trace id should be used, got %q", traceId)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "demo.echo" || span.SpanKind() != trace.SpanKindServer {
+		t.Fatalf("unexpected span %s %s", span.Name(), span.SpanKind())
+	}
+	if span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("unexpected parent %s", span.Parent().SpanID())
+	}
+	if span.Status().Code.String() != "Error" {
+		t.Fatalf("5xx should be marked as error, got %s", span.Status().Code)
+	}
+}
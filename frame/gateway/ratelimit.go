@@ -0,0 +1,224 @@
+package gateway
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+
+	"github.com/xbonlinenet/goup/frame/data"
+	"github.com/xbonlinenet/goup/frame/log"
+)
+
+// RateLimitKeyFunc 限流维度，返回值相同的请求共享同一个令牌桶
+type RateLimitKeyFunc func(c *gin.Context, apiContext *ApiContext) string
+
+// RateLimitByAPI 接口维度限流，所有请求共享令牌桶
+func RateLimitByAPI(c *gin.Context, apiContext *ApiContext) string {
+	return ""
+}
+
+// RateLimitByClientIP 按客户端 IP 限流
+func RateLimitByClientIP(c *gin.Context, apiContext *ApiContext) string {
+	return apiContext.ClientIP
+}
+
+// RateLimitByAppKey 按 AppKey 限流
+func RateLimitByAppKey(c *gin.Context, apiContext *ApiContext) string {
+	return apiContext.AppKey
+}
+
+// RateLimitByDeviceID 按设备限流
+func RateLimitByDeviceID(c *gin.Context, apiContext *ApiContext) string {
+	return apiContext.DeviceID
+}
+
+// rateLimitResult 一次取令牌的结果
+type rateLimitResult struct {
+	allowed bool
+	// tokens 取完令牌后桶中剩余的令牌数
+	tokens float64
+}
+
+type tokenBucketStore interface {
+	take(key string, rate float64, burst int) (*rateLimitResult, error)
+}
+
+// RateLimiter 令牌桶限流器，rate 为每秒生成的令牌数，burst 为桶的容量
+type RateLimiter struct {
+	rate    float64
+	burst   int
+	keyFunc RateLimitKeyFunc
+	store   tokenBucketStore
+}
+
+// NewRateLimiter 创建进程内的限流器，多实例部署时每个实例单独计数
+func NewRateLimiter(rate float64, burst int, keyFunc RateLimitKeyFunc) *RateLimiter {
+	return newRateLimiter(rate, burst, keyFunc, newLocalBucketStore())
+}
+
+// NewRedisRateLimiter 创建基于 Redis 的分布式限流器，redisName 为 data.redis 下配置的名称
+func NewRedisRateLimiter(redisName string, rate float64, burst int, keyFunc RateLimitKeyFunc) *RateLimiter {
+	return newRateLimiter(rate, burst, keyFunc, &redisBucketStore{redisName: redisName})
+}
+
+func newRateLimiter(rate float64, burst int, keyFunc RateLimitKeyFunc, store tokenBucketStore) *RateLimiter {
+	if rate <= 0 || burst <= 0 {
+		panic("rate and burst of rate limiter must be positive")
+	}
+	if keyFunc == nil {
+		keyFunc = RateLimitByAPI
+	}
+	return &RateLimiter{
+		rate:    rate,
+		burst:   burst,
+		keyFunc: keyFunc,
+		store:   store,
+	}
+}
+
+// RateLimit 接口限流，同一个 RateLimiter 用于多个接口时，每个接口单独计数
+func RateLimit(limiter *RateLimiter) Option {
+	return optionFunc(func(handler *HandlerInfo) {
+		handler.rateLimiter = limiter
+	})
+}
+
+// allow 检查请求是否被限流，并写入 X-RateLimit-* 响应头
+func (l *RateLimiter) allow(c *gin.Context, apiContext *ApiContext, apiKey string) bool {
+	key := fmt.Sprintf("%s:%s", apiKey, l.keyFunc(c, apiContext))
+
+	result, err := l.store.take(key, l.rate, l.burst)
+	if err != nil {
+		// 限流存储异常时放行，避免影响业务
+		log.Default().Warn("rate limit error", zap.String("api", apiKey), zap.Error(err))
+		return true
+	}
+
+	c.Header("X-RateLimit-Limit", strconv.Itoa(l.burst))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(int(math.Max(0, math.Floor(result.tokens)))))
+	c.Header("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil((float64(l.burst)-result.tokens)/l.rate))))
+
+	if result.allowed {
+		return true
+	}
+
+	// 等待生成一个完整的令牌
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil((1-result.tokens)/l.rate))))
+	return false
+}
+
+type localBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// localBucketStore 进程内的令牌桶
+type localBucketStore struct {
+	mutex     sync.Mutex
+	buckets   map[string]*localBucket
+	lastSweep time.Time
+}
+
+func newLocalBucketStore() *localBucketStore {
+	return &localBucketStore{
+		buckets:   make(map[string]*localBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *localBucketStore) take(key string, rate float64, burst int) (*rateLimitResult, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	// 令牌桶填满后和新建的桶没有区别，定期清理避免 key 过多占用内存
+	fullAfter := time.Duration(float64(burst) / rate * float64(time.Second))
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, b := range s.buckets {
+			if now.Sub(b.last) > fullAfter {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &localBucket{tokens: float64(burst), last: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return &rateLimitResult{allowed: false, tokens: b.tokens}, nil
+	}
+	b.tokens--
+	return &rateLimitResult{allowed: true, tokens: b.tokens}, nil
+}
+
+// tokenBucketScript 在 Redis 中原子的计算令牌桶
+// Lua 的数字返回给 Redis 时会被截断为整数，剩余令牌数以字符串返回
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) / 1000 * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// redisBucketStore 基于 Redis 的令牌桶，多实例共享
+type redisBucketStore struct {
+	redisName string
+}
+
+func (s *redisBucketStore) take(key string, rate float64, burst int) (*rateLimitResult, error) {
+	client, err := data.GetRedis(s.redisName)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	ret, err := tokenBucketScript.Run(client, []string{"goup:ratelimit:" + key}, rate, burst, now).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	values, ok := ret.([]interface{})
+	if !ok || len(values) != 2 {
+		return nil, fmt.Errorf("unexpected rate limit script result: %v", ret)
+	}
+
+	tokens, err := cast.ToFloat64E(values[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return &rateLimitResult{allowed: cast.ToInt64(values[0]) == 1, tokens: tokens}, nil
+}
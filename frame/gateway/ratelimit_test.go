@@ -0,0 +1,32 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocalBucketStore(t *testing.T) {
+	store := newLocalBucketStore()
+
+	for i := 0; i < 3; i++ {
+		result, _ := store.take("a", 10, 3)
+		if !result.allowed {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+
+	result, _ := store.take("a", 10, 3)
+	if result.allowed {
+		t.Fatalf("request should be limited when the bucket is empty")
+	}
+
+	// 其他 key 不受影响
+	if result, _ := store.take("b", 10, 3); !result.allowed {
+		t.Fatalf("other key should be allowed")
+	}
+
+	time.Sleep(120 * time.Millisecond)
+	if result, _ := store.take("a", 10, 3); !result.allowed {
+		t.Fatalf("token should be refilled")
+	}
+}
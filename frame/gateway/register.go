@@ -18,47 +18,105 @@ func GetApiList() []*API {
 // RegisterAPI 格式化的返回
 func RegisterAPI(group string, key, name string, handler Handler, opts ...Option) {
 
-	req, resp, reqType := getHandlerInOutParamInfo(handler)
+	reqType, respType := getHandlerInOutParamType(handler)
+	handlerType := reflect.ValueOf(handler).Type()
+
+	// newHandler 创建 Handler 并设置请求参数
+	newHandler := func(request interface{}) reflect.Value {
+		h := reflect.New(handlerType).Elem()
+		h.FieldByName("Request").Set(reflect.ValueOf(request).Elem())
+		return h
+	}
 
-	// 构建接口文档
-	apis = append(apis, &API{
-		LineNum:  0,
-		Key:      key,
-		Name:     name,
-		Group:    group,
-		ReqType:  reqType,
-		Request:  req,
-		Response: resp,
-	})
+	registerHandler(group, key, name, reqType, respType, &HandlerInfo{
+		newRequest: func() interface{} {
+			return reflect.New(reqType).Interface()
+		},
+		call: func(apiContext *ApiContext, request interface{}) (interface{}, error) {
+			return newHandler(request).Interface().(Handler).Handler(apiContext)
+		},
+		mock: func(request interface{}) interface{} {
+			mock := newHandler(request).MethodByName("Mock")
+			if !mock.IsValid() {
+				return reflect.New(respType).Interface()
+			}
+			return mock.Call([]reflect.Value{})[0].Interface()
+		},
+	}, opts...)
+}
+
+// Register 使用泛型注册接口，Req、Resp 为请求和响应的结构体，请求时不再需要反射调用 Handler
+//
+//	gateway.Register("demo", "echo", "Echo", func(c *gateway.ApiContext, req *EchoRequest) (*EchoResponse, error) {
+//		return &EchoResponse{Message: req.Message}, nil
+//	})
+//
+// 请求头 Mock: true 时返回 MockResponse 设置的数据，没有设置时返回 Resp 的零值
+func Register[Req, Resp any](group, key, name string, fn func(*ApiContext, *Req) (*Resp, error), opts ...Option) {
+	reqType := reflect.TypeOf((*Req)(nil)).Elem()
+	respType := reflect.TypeOf((*Resp)(nil)).Elem()
+
+	registerHandler(group, key, name, reqType, respType, &HandlerInfo{
+		newRequest: func() interface{} {
+			return new(Req)
+		},
+		call: func(apiContext *ApiContext, request interface{}) (interface{}, error) {
+			return fn(apiContext, request.(*Req))
+		},
+		mock: func(request interface{}) interface{} {
+			return new(Resp)
+		},
+	}, opts...)
+}
 
+func registerHandler(group, key, name string, reqType, respType reflect.Type, handlerInfo *HandlerInfo, opts ...Option) {
 	apiKey := fmt.Sprintf("%s.%s", group, key)
 	//  注册到中间件中
 	if _, ok := apiHandlerFuncMap[apiKey]; ok {
 		panic(fmt.Errorf("%s already registered", key))
 	}
 
-	handlerInfo := &HandlerInfo{
-		reqType: reqType,
-		handler: reflect.ValueOf(handler).Type(),
-		expire:  10 * time.Minute,
-		pt:      jsonType,
-	}
+	handlerInfo.reqType = reqType
+	handlerInfo.sources = newRequestSources(reqType)
+	handlerInfo.expire = 10 * time.Minute
+	handlerInfo.pt = jsonType
 
 	for _, opt := range opts {
 		opt.apply(handlerInfo)
 	}
 
+	api := &API{
+		LineNum:  0,
+		Key:      key,
+		Name:     name,
+		Group:    group,
+		ReqType:  reqType,
+		RespType: respType,
+		Request:  getDTOFieldInfo(reqType, false),
+		Response: getDTOFieldInfo(respType, false),
+	}
+	if handlerInfo.route != nil {
+		addRoute(handlerInfo.route, apiKey)
+		api.Method = handlerInfo.route.method
+		api.Path = handlerInfo.route.path
+	}
+
+	// 构建接口文档
+	apis = append(apis, api)
 	apiHandlerFuncMap[apiKey] = handlerInfo
 }
 
-func getHandlerInOutParamInfo(handler Handler) (in, out *DTOInfo, reqType reflect.Type) {
+func getHandlerInOutParamType(handler Handler) (reqType, respType reflect.Type) {
 	req, ok := reflect.ValueOf(handler).Type().FieldByName("Request")
 	if !ok {
 		panic("not contains Request field")
 	}
+	resp, ok := reflect.ValueOf(handler).Type().FieldByName("Response")
+	if !ok {
+		panic("not contains Response field")
+	}
 
-	return getDTOFieldInfo(reflect.ValueOf(handler).FieldByName("Request").Type(), false),
-		getDTOFieldInfo(reflect.ValueOf(handler).FieldByName("Response").Type(), false), req.Type
+	return req.Type, resp.Type
 }
 
 func getDTOFieldInfo(dto reflect.Type, sub bool) *DTOInfo {
@@ -87,6 +145,11 @@ func getDTOFieldInfoImpl(dto reflect.Type, sub bool, foundTypes map[string]struc
 		}
 	}
 
+	if dto.Kind() == reflect.Chan {
+		// 流式响应，文档展示 channel 中的元素
+		return getDTOFieldInfoImpl(dto.Elem(), sub, foundTypes)
+	}
+
 	if dto.Kind() == reflect.Interface {
 		return &DTOInfo{
 			fields: fields,
@@ -124,6 +187,9 @@ func getDTOFieldInfoImpl(dto reflect.Type, sub bool, foundTypes map[string]struc
 				info := getDTOFieldInfoImpl(field.Type, true, foundTypes)
 				types = append(types, info.types...)
 
+			} else if isFileType(field.Type) {
+				// 上传的文件，不展开 multipart.FileHeader
+
 			} else if field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct {
 				// 处理 *Foo
 				// fmt.Printf("ptr type: %s\n", field.Type.Elem().String())
@@ -161,8 +227,11 @@ func getDTOFieldInfoImpl(dto reflect.Type, sub bool, foundTypes map[string]struc
 				types = append(types, info.types...)
 			}
 
+			source := fieldSource(field)
 			fieldName := ""
-			if tag.Get("json") == "" {
+			if source == sourcePath || source == sourceHeader || source == sourceCookie {
+				fieldName = tagName(field, source)
+			} else if tag.Get("json") == "" {
 				fieldName = strings.Split(tag.Get("form"), ",")[0]
 			} else {
 				fieldName = strings.Split(tag.Get("json"), ",")[0]
@@ -183,6 +252,7 @@ func getDTOFieldInfoImpl(dto reflect.Type, sub bool, foundTypes map[string]struc
 				typ:      field.Type.String(),
 				required: required,
 				note:     "todo for binding",
+				source:   source,
 			}
 
 			fields = append(fields, &filedInfo)
@@ -0,0 +1,80 @@
+package gateway
+
+import (
+	"errors"
+	"testing"
+)
+
+type registerRequest struct {
+	Message string `json:"message" binding:"required" desc:"消息"`
+}
+
+type registerResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type registerStructHandler struct {
+	Request  registerRequest
+	Response registerResponse
+}
+
+func (h registerStructHandler) Handler(c *ApiContext) (interface{}, error) {
+	return &registerResponse{Message: h.Request.Message}, nil
+}
+
+func (h registerStructHandler) Mock() interface{} {
+	return &registerResponse{Message: "mock"}
+}
+
+func TestRegister(t *testing.T) {
+	errEmpty := errors.New("empty message")
+
+	RegisterAPI("register", "struct", "struct api", registerStructHandler{})
+	Register("register", "typed", "typed api", func(c *ApiContext, req *registerRequest) (*registerResponse, error) {
+		if req.Message == "" {
+			return nil, errEmpty
+		}
+		return &registerResponse{Message: req.Message}, nil
+	})
+	Register("register", "mock", "mock api", func(c *ApiContext, req *registerRequest) (*registerResponse, error) {
+		return nil, nil
+	}, MockResponse(&registerResponse{Message: "mock"}))
+
+	tests := []struct {
+		key     string
+		message string
+		want    string
+		err     error
+		mock    string
+	}{
+		{key: "register.struct", message: "hello", want: "hello", mock: "mock"},
+		{key: "register.typed", message: "hello", want: "hello"},
+		{key: "register.typed", err: errEmpty},
+		{key: "register.mock", mock: "mock"},
+	}
+	for _, tt := range tests {
+		handler := apiHandlerFuncMap[tt.key]
+
+		request := handler.newRequest()
+		request.(*registerRequest).Message = tt.message
+
+		resp, err := handler.call(&ApiContext{}, request)
+		if err != tt.err {
+			t.Errorf("%s: err = %v, want %v", tt.key, err, tt.err)
+		}
+		if tt.want != "" && resp.(*registerResponse).Message != tt.want {
+			t.Errorf("%s: resp = %+v", tt.key, resp)
+		}
+		if mock := handler.mock(request).(*registerResponse); mock.Message != tt.mock {
+			t.Errorf("%s: mock = %+v", tt.key, mock)
+		}
+	}
+
+	// 泛型注册的接口同样生成文档
+	for _, api := range apis {
+		if api.Group == "register" && (api.ReqType.Name() != "registerRequest" || len(api.Request.fields) != 1) {
+			t.Errorf("%s: doc not generated", api.Key)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package gateway
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/xbonlinenet/goup/frame/cache"
+	"github.com/xbonlinenet/goup/frame/log"
+	"github.com/xbonlinenet/goup/frame/util"
+)
+
+const (
+	// responseCacheHeader 响应中标记是否命中缓存
+	responseCacheHeader = "X-Cache"
+	// cacheTagExpiration 标签版本的有效期，需要大于缓存的 ttl
+	cacheTagExpiration = 7 * 24 * time.Hour
+)
+
+// responseCacheCounter 统计响应缓存的命中情况，result 为 hit、miss、bypass、error
+var responseCacheCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "response_cache",
+	Help: "response cache result by api",
+}, []string{"api", "result"})
+
+// CacheKeyFunc 缓存的维度，返回值相同的请求共享缓存
+type CacheKeyFunc func(c *ApiContext, request interface{}) string
+
+// CacheTagFunc 缓存的标签，用于写接口失效相关的缓存
+type CacheTagFunc func(c *ApiContext, request interface{}) []string
+
+// CacheKeyByRequest 请求参数相同的请求共享缓存
+func CacheKeyByRequest(c *ApiContext, request interface{}) string {
+	b, _ := json.Marshal(request)
+	return string(b)
+}
+
+// CacheKeyByUser 请求参数和用户都相同的请求共享缓存
+func CacheKeyByUser(c *ApiContext, request interface{}) string {
+	return c.UserID() + ":" + CacheKeyByRequest(c, request)
+}
+
+// CacheKeyByAppKey 请求参数和 AppKey 都相同的请求共享缓存
+func CacheKeyByAppKey(c *ApiContext, request interface{}) string {
+	return c.AppKey + ":" + CacheKeyByRequest(c, request)
+}
+
+type responseCache struct {
+	ttl   time.Duration
+	keyFn CacheKeyFunc
+	// codec 缓存使用的 cache.Codec，请求时才获取，避免注册接口时配置还没有加载
+	codec func() (*cache.Codec, error)
+}
+
+// CacheResponse 缓存接口的响应，keyFn 为空时使用 CacheKeyByRequest。
+//
+// 只缓存 HTTP 200 并且 code 为 ErrOK 的响应，PreHandler（鉴权等）在读取缓存之前执行。
+// 响应按调用方加密（WithCryptoHandler）的接口不缓存。缓存使用 gateway.cache.codec 配置的 cache.Codec，
+// 默认为 gateway，Redis 和进程内 LRU 通过 cache.<name> 配置，LRU 的有效期使用 cache.<name>.lru-expire-duration。
+// gateway.cache.trusted_app_keys 中的调用方请求头带有 Cache-Control: no-cache 时不读取缓存
+func CacheResponse(ttl time.Duration, keyFn CacheKeyFunc) Option {
+	if keyFn == nil {
+		keyFn = CacheKeyByRequest
+	}
+	return optionFunc(func(handler *HandlerInfo) {
+		handler.cache = &responseCache{ttl: ttl, keyFn: keyFn, codec: getResponseCacheCodec}
+	})
+}
+
+// CacheTags 设置缓存的标签，使用 InvalidateCacheTags 或者 EvictCacheTags 失效标签下的所有缓存
+func CacheTags(fn CacheTagFunc) Option {
+	return optionFunc(func(handler *HandlerInfo) {
+		handler.cacheTags = fn
+	})
+}
+
+// EvictCacheTags 写接口返回成功后失效标签下的缓存
+func EvictCacheTags(fn CacheTagFunc) Option {
+	return optionFunc(func(handler *HandlerInfo) {
+		handler.evictTags = fn
+	})
+}
+
+// getResponseCacheCodec Redis 没有配置时 cache.GetCacheCodec 会 panic，转换为错误，请求按不缓存处理
+func getResponseCacheCodec() (codec *cache.Codec, err error) {
+	name := viper.GetString("gateway.cache.codec")
+	if name == "" {
+		name = "gateway"
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("response cache codec %s: %v", name, r)
+		}
+	}()
+	return cache.GetCacheCodec(name), nil
+}
+
+// InvalidateCacheTags 失效标签下的所有响应缓存
+//
+// 标签通过版本号实现，失效时更新版本号，旧的缓存不再被读取，到期后自动删除。
+// 开启进程内 LRU 时，其他实例在 LRU 过期后才能读到新的版本号
+func InvalidateCacheTags(tags ...string) error {
+	codec, err := getResponseCacheCodec()
+	if err != nil {
+		return err
+	}
+	return invalidateCacheTags(codec, tags)
+}
+
+func invalidateCacheTags(codec *cache.Codec, tags []string) error {
+	version := strconv.FormatInt(time.Now().UnixNano(), 36)
+	for _, tag := range tags {
+		err := codec.Set(&cache.Item{
+			Key:        cacheTagKey(tag),
+			Object:     version,
+			Expiration: cacheTagExpiration,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cacheTagKey(tag string) string {
+	return "goup:resp:tag:" + tag
+}
+
+// key 缓存的 key，包含标签的版本号
+func (rc *responseCache) key(codec *cache.Codec, apiKey string, c *ApiContext, request interface{}, tags []string) string {
+	sb := strings.Builder{}
+	sb.WriteString(c.Request.URL.Path)
+	// 不同格式的响应分开缓存，json 不加入 key，保持和之前的 key 相同
+	if format := negotiateFormat(c.Request.Header.Get("Accept")); format != binding.MIMEJSON {
+		sb.WriteString(" " + format)
+	}
+	sb.WriteString("\n")
+	sb.WriteString(rc.keyFn(c, request))
+
+	sort.Strings(tags)
+	for _, tag := range tags {
+		var version string
+		if err := codec.Get(cacheTagKey(tag), &version); err != nil {
+			version = "0"
+		}
+		sb.WriteString("\n" + tag + "=" + version)
+	}
+
+	sum := sha1.Sum([]byte(sb.String()))
+	return "goup:resp:" + apiKey + ":" + hex.EncodeToString(sum[:])
+}
+
+// cachedRequest 没有命中缓存的请求，处理完成后保存响应
+type cachedRequest struct {
+	rc         *responseCache
+	codec      *cache.Codec
+	key        string
+	writer     *responseRecorder
+	apiContext *ApiContext
+}
+
+// begin 读取缓存，命中时写入响应并返回 true；缓存不可用时返回 nil，按普通请求处理
+func (rc *responseCache) begin(c *gin.Context, apiContext *ApiContext, apiKey string, request interface{}, tagFn CacheTagFunc) (*cachedRequest, bool) {
+	codec, err := rc.codec()
+	if err != nil {
+		log.Default().Error("response cache unavailable", zap.String("api", apiKey), zap.Error(err))
+		responseCacheCounter.WithLabelValues(apiKey, "error").Inc()
+		return nil, false
+	}
+
+	var tags []string
+	if tagFn != nil {
+		tags = tagFn(apiContext, request)
+	}
+	key := rc.key(codec, apiKey, apiContext, request, tags)
+
+	if noCache(c) && isTrustedCacheCaller(apiContext) {
+		responseCacheCounter.WithLabelValues(apiKey, "bypass").Inc()
+	} else {
+		var cached recordedResponse
+		err := codec.Get(key, &cached)
+		if err == nil {
+			responseCacheCounter.WithLabelValues(apiKey, "hit").Inc()
+			c.Header(responseCacheHeader, "HIT")
+			cached.writeTo(c)
+			return nil, true
+		}
+		if err != cache.ErrCacheMiss {
+			log.Default().Warn("response cache error", zap.String("api", apiKey), zap.Error(err))
+		}
+		responseCacheCounter.WithLabelValues(apiKey, "miss").Inc()
+	}
+
+	c.Header(responseCacheHeader, "MISS")
+	return &cachedRequest{
+		rc:         rc,
+		codec:      codec,
+		key:        key,
+		writer:     recordResponse(c),
+		apiContext: apiContext,
+	}, false
+}
+
+// finish 保存成功的响应，业务错误（包括 Handler 返回的普通错误）不缓存
+func (r *cachedRequest) finish(c *gin.Context) {
+	response := r.writer.response(r.apiContext)
+	if response == nil || response.Status != http.StatusOK {
+		return
+	}
+	if code, ok := c.Get(resultCodeKey); !ok || code != ErrOK {
+		return
+	}
+
+	err := r.codec.Set(&cache.Item{
+		Key:        r.key,
+		Object:     response,
+		Expiration: r.rc.ttl,
+	})
+	if err != nil {
+		log.Default().Warn("save response cache error", zap.String("key", r.key), zap.Error(err))
+	}
+}
+
+// evictCacheTags 写接口成功后失效缓存
+func evictCacheTags(c *gin.Context, apiContext *ApiContext, request interface{}, tagFn CacheTagFunc) {
+	if c.Writer.Status() >= http.StatusBadRequest {
+		return
+	}
+	tags := tagFn(apiContext, request)
+	if len(tags) == 0 {
+		return
+	}
+	if err := InvalidateCacheTags(tags...); err != nil {
+		log.Default().Warn("evict response cache error", zap.Strings("tags", tags), zap.Error(err))
+	}
+}
+
+func noCache(c *gin.Context) bool {
+	for _, directive := range strings.Split(c.GetHeader("Cache-Control"), ",") {
+		if strings.TrimSpace(directive) == "no-cache" {
+			return true
+		}
+	}
+	return c.GetHeader("Pragma") == "no-cache"
+}
+
+// isTrustedCacheCaller 只有配置的调用方可以跳过缓存，避免客户端绕过缓存
+func isTrustedCacheCaller(c *ApiContext) bool {
+	if c.AppKey == "" {
+		return false
+	}
+	trusted := cast.ToStringSlice(viper.Get("gateway.cache.trusted_app_keys"))
+	return util.StringArrayContains(trusted, c.AppKey)
+}
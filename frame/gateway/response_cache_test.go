@@ -0,0 +1,158 @@
+package gateway
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+
+	"github.com/xbonlinenet/goup/frame/cache"
+)
+
+type cacheTestRequest struct {
+	ID int `json:"id"`
+}
+
+func TestResponseCache(t *testing.T) {
+	codec := cache.BuildCacheCodec("gateway-test", nil, true, 100, time.Minute)
+	rc := &responseCache{ttl: time.Minute, keyFn: CacheKeyByRequest, codec: func() (*cache.Codec, error) { return codec, nil }}
+	tags := func(c *ApiContext, request interface{}) []string {
+		return []string{"item:1"}
+	}
+
+	call := func(request *cacheTestRequest, header http.Header, appKey string) (*httptest.ResponseRecorder, bool) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/item/get", nil)
+		for k, v := range header {
+			c.Request.Header[k] = v
+		}
+		apiContext := &ApiContext{Request: c.Request, AppKey: appKey, respHeaders: map[string]string{}}
+
+		cached, done := rc.begin(c, apiContext, "item.get", request, tags)
+		if done {
+			return w, true
+		}
+		setResultCode(c, ErrOK)
+		c.JSON(http.StatusOK, gin.H{"id": request.ID, "at": time.Now().UnixNano()})
+		cached.finish(c)
+		return w, false
+	}
+
+	first, hit := call(&cacheTestRequest{ID: 1}, nil, "")
+	if hit || first.Header().Get(responseCacheHeader) != "MISS" {
+		t.Fatal("first request should miss")
+	}
+
+	second, hit := call(&cacheTestRequest{ID: 1}, nil, "")
+	if !hit || second.Body.String() != first.Body.String() || second.Header().Get(responseCacheHeader) != "HIT" {
+		t.Fatalf("second request should hit, got %s", second.Body.String())
+	}
+	if second.Header().Get("Content-Type") != first.Header().Get("Content-Type") {
+		t.Fatalf("content type should be cached, got %q", second.Header().Get("Content-Type"))
+	}
+
+	// 请求参数不同
+	if _, hit := call(&cacheTestRequest{ID: 2}, nil, ""); hit {
+		t.Fatal("different request should miss")
+	}
+
+	// 只有信任的调用方可以跳过缓存
+	noCacheHeader := http.Header{"Cache-Control": []string{"no-cache"}}
+	if _, hit := call(&cacheTestRequest{ID: 1}, noCacheHeader, "client"); !hit {
+		t.Fatal("untrusted caller should not bypass cache")
+	}
+	viper.Set("gateway.cache.trusted_app_keys", []string{"admin"})
+	defer viper.Set("gateway.cache.trusted_app_keys", nil)
+	if _, hit := call(&cacheTestRequest{ID: 1}, noCacheHeader, "admin"); hit {
+		t.Fatal("trusted caller should bypass cache")
+	}
+
+	// 失效标签后重新读取
+	if err := invalidateCacheTags(codec, []string{"item:1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, hit := call(&cacheTestRequest{ID: 1}, nil, ""); hit {
+		t.Fatal("request should miss after tag invalidated")
+	}
+	if _, hit := call(&cacheTestRequest{ID: 1}, nil, ""); !hit {
+		t.Fatal("request should hit again")
+	}
+}
+
+func TestResponseCacheUnavailable(t *testing.T) {
+	// Redis 没有初始化时按不缓存处理
+	viper.Set("gateway.cache.codec", "gateway-unconfigured")
+	defer viper.Set("gateway.cache.codec", nil)
+	if _, err := getResponseCacheCodec(); err == nil {
+		t.Fatal("unconfigured codec should return error")
+	}
+
+	rc := &responseCache{ttl: time.Minute, keyFn: CacheKeyByRequest, codec: getResponseCacheCodec}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/item/get", nil)
+	apiContext := &ApiContext{Request: c.Request, respHeaders: map[string]string{}}
+	if cached, done := rc.begin(c, apiContext, "item.get", &cacheTestRequest{ID: 1}, nil); cached != nil || done {
+		t.Fatal("request should be served without cache")
+	}
+	if w.Header().Get(responseCacheHeader) != "" {
+		t.Fatal("cache header should not be set")
+	}
+}
+
+func TestResponseCacheSkipsFailures(t *testing.T) {
+	codec := cache.BuildCacheCodec("gateway-failure-test", nil, true, 100, time.Minute)
+	cacheOption := CacheResponse(time.Minute, nil)
+
+	var failed, encrypted int32
+	Register("cache", "failed", "failed api", func(c *ApiContext, req *registerRequest) (*registerResponse, error) {
+		atomic.AddInt32(&failed, 1)
+		return nil, errors.New("db error")
+	}, cacheOption)
+	Register("cache", "encrypted", "encrypted api", func(c *ApiContext, req *registerRequest) (*registerResponse, error) {
+		atomic.AddInt32(&encrypted, 1)
+		return &registerResponse{Message: req.Message}, nil
+	}, cacheOption, WithCryptoHandler(NewCryptoHandler(func(c *gin.Context, d interface{}) string {
+		return "encrypted for " + c.GetHeader(HeaderAppKey)
+	}, nil)))
+	for _, key := range []string{"cache.failed", "cache.encrypted"} {
+		apiHandlerFuncMap[key].cache.codec = func() (*cache.Codec, error) { return codec, nil }
+	}
+
+	r := newTestAPIEngine()
+	serve := func(api, appKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/cache/"+api, bytes.NewBufferString(`{"message":"hello"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(HeaderAppKey, appKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Handler 返回的普通错误是 HTTP 200 和 ErrLogicError，不缓存
+	for i := 0; i < 2; i++ {
+		if w := serve("failed", "app"); w.Header().Get(responseCacheHeader) == "HIT" {
+			t.Fatalf("failed response should not be cached: %s", w.Body.String())
+		}
+	}
+	if n := atomic.LoadInt32(&failed); n != 2 {
+		t.Fatalf("failed handler should run every time, got %d", n)
+	}
+
+	// 加密的响应不能返回给其他调用方
+	serve("encrypted", "app1")
+	if w := serve("encrypted", "app2"); !strings.Contains(w.Body.String(), "encrypted for app2") {
+		t.Fatalf("encrypted response should not be shared, got %s", w.Body.String())
+	}
+	if n := atomic.LoadInt32(&encrypted); n != 2 {
+		t.Fatalf("encrypted handler should run every time, got %d", n)
+	}
+}
@@ -0,0 +1,77 @@
+package gateway
+
+import (
+	"bytes"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordedResponse 保存的响应，用于幂等和响应缓存
+type recordedResponse struct {
+	Status int               `json:"status"`
+	Header map[string]string `json:"header"`
+	Body   []byte            `json:"body"`
+}
+
+// writeTo 写入保存的响应
+func (r *recordedResponse) writeTo(c *gin.Context) {
+	for k, v := range r.Header {
+		c.Header(k, v)
+	}
+	c.Status(r.Status)
+	_, _ = c.Writer.Write(r.Body)
+	c.Abort()
+}
+
+// responseRecorder 记录写入的响应。下层的 Writer（响应压缩）可能缓存数据，
+// Written() 在请求结束前不一定为 true，是否写入由 responseRecorder 自己记录
+type responseRecorder struct {
+	gin.ResponseWriter
+	body    bytes.Buffer
+	written bool
+}
+
+// recordResponse 替换 c.Writer，记录之后写入的响应
+func recordResponse(c *gin.Context) *responseRecorder {
+	w := &responseRecorder{ResponseWriter: c.Writer}
+	c.Writer = w
+	return w
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.written = true
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.written = true
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// WriteHeaderNow 没有 body 的响应（204 等）只写入状态码
+func (w *responseRecorder) WriteHeaderNow() {
+	w.written = true
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// response 写入的响应，只保存 Content-Type 和 Handler 设置的响应头，没有写入时返回 nil
+func (w *responseRecorder) response(apiContext *ApiContext) *recordedResponse {
+	if !w.written && !w.Written() {
+		return nil
+	}
+
+	header := map[string]string{}
+	if contentType := w.Header().Get("Content-Type"); contentType != "" {
+		header["Content-Type"] = contentType
+	}
+	for k, v := range apiContext.respHeaders {
+		header[k] = v
+	}
+	return &recordedResponse{
+		Status: w.Status(),
+		Header: header,
+		Body:   w.body.Bytes(),
+	}
+}
@@ -0,0 +1,200 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/spf13/cast"
+)
+
+// restRoute RESTful 接口的请求方法和路径模板
+type restRoute struct {
+	method string
+	// path 相对于接口前缀的路径模板，如 /users/:id
+	path     string
+	segments []string
+	apiKey   string
+}
+
+var restRoutes []*restRoute
+
+// Route 使用请求方法和路径模板注册接口，路径相对于接口前缀，如 Route(http.MethodGet, "/users/:id")
+//
+// 路径参数通过 path tag 绑定到 Request 中，GET、HEAD、DELETE 请求的其他参数从 query 中读取。
+// GET 接口同时响应 HEAD 请求，路径匹配但是请求方法不匹配时返回 405。使用 Route 注册的接口不再响应 /group/key 形式的路径。
+func Route(method, path string) Option {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	method = strings.ToUpper(method)
+
+	return optionFunc(func(handler *HandlerInfo) {
+		handler.route = &restRoute{
+			method:   method,
+			path:     path,
+			segments: splitPath(path),
+		}
+
+		switch method {
+		case http.MethodGet, http.MethodHead, http.MethodDelete:
+			handler.pt = formType
+		}
+	})
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// addRoute 添加 RESTful 路由，相同的方法和路径不能重复注册
+func addRoute(route *restRoute, apiKey string) {
+	for _, r := range restRoutes {
+		if r.method == route.method && r.template() == route.template() {
+			panic(fmt.Errorf("route %s %s already registered by %s", route.method, route.path, r.apiKey))
+		}
+	}
+	route.apiKey = apiKey
+	restRoutes = append(restRoutes, route)
+
+	// 静态路径优先匹配，如 /users/me 优先于 /users/:id
+	sort.SliceStable(restRoutes, func(i, j int) bool {
+		return restRoutes[i].specificity() > restRoutes[j].specificity()
+	})
+}
+
+// template 忽略参数名后的路径，用于判断路由是否冲突
+func (r *restRoute) template() string {
+	segments := make([]string, len(r.segments))
+	for i, s := range r.segments {
+		if strings.HasPrefix(s, ":") {
+			s = ":"
+		}
+		segments[i] = s
+	}
+	return strings.Join(segments, "/")
+}
+
+func (r *restRoute) specificity() int {
+	n := 0
+	for _, s := range r.segments {
+		if !strings.HasPrefix(s, ":") {
+			n++
+		}
+	}
+	return n
+}
+
+// match 匹配路径，返回路径参数
+func (r *restRoute) match(segments []string) (gin.Params, bool) {
+	if len(segments) != len(r.segments) {
+		return nil, false
+	}
+
+	var params gin.Params
+	for i, s := range r.segments {
+		if strings.HasPrefix(s, ":") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params = append(params, gin.Param{Key: s[1:], Value: segments[i]})
+		} else if s != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// findRoute 查找 RESTful 路由，路径匹配但方法不匹配时返回允许的方法
+func findRoute(method, path string) (*restRoute, gin.Params, []string) {
+	segments := splitPath(path)
+
+	var allowed []string
+	var get *restRoute
+	var getParams gin.Params
+	for _, r := range restRoutes {
+		params, ok := r.match(segments)
+		if !ok {
+			continue
+		}
+		// OPTIONS 预检请求交给路径匹配的接口处理 CORS
+		if r.method == method || method == http.MethodOptions {
+			return r, params, nil
+		}
+		if method == http.MethodHead && r.method == http.MethodGet && get == nil {
+			get, getParams = r, params
+		}
+		allowed = append(allowed, r.method)
+	}
+	// 没有注册 HEAD 时使用 GET 的接口处理，不返回响应体
+	if get != nil {
+		return get, getParams, nil
+	}
+	return nil, nil, allowed
+}
+
+// routePath 接口对外的路径，request 不为空时使用其中的路径参数替换模板
+func (r *restRoute) routePath(request interface{}) string {
+	var values map[string]string
+	if request != nil {
+		values = pathParamValues(request)
+	}
+
+	segments := make([]string, len(r.segments))
+	for i, s := range r.segments {
+		if strings.HasPrefix(s, ":") {
+			if v, ok := values[s[1:]]; ok {
+				s = v
+			} else {
+				s = "{" + s[1:] + "}"
+			}
+		}
+		segments[i] = s
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// pathParamValues 读取 request 中 path tag 字段的值
+func pathParamValues(request interface{}) map[string]string {
+	values := map[string]string{}
+	v := reflect.Indirect(reflect.ValueOf(request))
+	if v.Kind() != reflect.Struct {
+		return values
+	}
+	walkFields(v.Type(), func(field reflect.StructField) {
+		name := field.Tag.Get("path")
+		if name == "" || name == "-" {
+			return
+		}
+		// walkFields 返回的是嵌入结构体中的字段，需要按名称重新查找
+		sf, ok := v.Type().FieldByName(field.Name)
+		if !ok {
+			return
+		}
+		if fv, err := v.FieldByIndexErr(sf.Index); err == nil {
+			values[name] = cast.ToString(fv.Interface())
+		}
+	})
+	return values
+}
+
+// bindPathParams 将路径参数绑定到 path tag 的字段，校验在绑定 body/query 时统一进行
+func bindPathParams(request interface{}, params gin.Params) error {
+	if len(params) == 0 {
+		return nil
+	}
+	values := make(map[string][]string, len(params))
+	for _, p := range params {
+		values[p.Key] = []string{p.Value}
+	}
+	return binding.MapFormWithTag(request, values, "path")
+}
+
+// PathParam 获取路径参数
+func (c *ApiContext) PathParam(key string) string {
+	return c.pathParams.ByName(key)
+}
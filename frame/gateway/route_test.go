@@ -0,0 +1,101 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type routeRequest struct {
+	ID   int64  `path:"id" json:"-" binding:"required" desc:"用户 ID"`
+	Name string `json:"name"`
+}
+
+type routeHandler struct {
+	Request  routeRequest
+	Response registerResponse
+}
+
+func (h routeHandler) Handler(c *ApiContext) (interface{}, error) {
+	return &registerResponse{}, nil
+}
+
+func TestFindRoute(t *testing.T) {
+	RegisterAPI("route", "get", "get user", routeHandler{}, Route(http.MethodGet, "/route/users/:id"))
+	RegisterAPI("route", "update", "update user", routeHandler{}, Route(http.MethodPut, "/route/users/:id"))
+	RegisterAPI("route", "me", "current user", routeHandler{}, Route(http.MethodGet, "/route/users/me"))
+
+	tests := []struct {
+		method  string
+		path    string
+		apiKey  string
+		params  gin.Params
+		allowed []string
+	}{
+		{method: "GET", path: "route/users/12", apiKey: "route.get", params: gin.Params{{Key: "id", Value: "12"}}},
+		{method: "PUT", path: "route/users/12/", apiKey: "route.update", params: gin.Params{{Key: "id", Value: "12"}}},
+		{method: "GET", path: "route/users/me", apiKey: "route.me"},
+		{method: "HEAD", path: "route/users/12", apiKey: "route.get", params: gin.Params{{Key: "id", Value: "12"}}},
+		{method: "OPTIONS", path: "route/users/12", apiKey: "route.get", params: gin.Params{{Key: "id", Value: "12"}}},
+		{method: "DELETE", path: "route/users/12", allowed: []string{"GET", "PUT"}},
+		{method: "GET", path: "route/users"},
+	}
+	for _, tt := range tests {
+		route, params, allowed := findRoute(tt.method, tt.path)
+		apiKey := ""
+		if route != nil {
+			apiKey = route.apiKey
+		}
+		if apiKey != tt.apiKey || !reflect.DeepEqual(params, tt.params) || !reflect.DeepEqual(allowed, tt.allowed) {
+			t.Errorf("findRoute(%s, %s) = %s, %v, %v", tt.method, tt.path, apiKey, params, allowed)
+		}
+	}
+
+	info := apiHandlerFuncMap["route.get"]
+	if info.pt != formType {
+		t.Errorf("GET route should bind query")
+	}
+
+	request := info.newRequest()
+	if err := bindPathParams(request, gin.Params{{Key: "id", Value: "12"}}); err != nil {
+		t.Fatal(err)
+	}
+	if request.(*routeRequest).ID != 12 {
+		t.Errorf("path param not bound: %+v", request)
+	}
+	if path := info.route.routePath(request); path != "/route/users/12" {
+		t.Errorf("routePath() = %s", path)
+	}
+
+	spec := OpenAPISpec()
+	op := spec.Paths["/api/route/users/{id}"]["put"]
+	if op == nil || len(op.Parameters) != 1 || op.Parameters[0].In != "path" || op.RequestBody == nil {
+		t.Errorf("openapi operation = %+v", op)
+	}
+
+	// 接口详情使用配置的接口前缀
+	apiPathPrefix = "/v1/"
+	defer func() { apiPathPrefix = kDefaultApiPathPrefix }()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/doc/detail?name=route.get", nil)
+	ApiDetail(c)
+	if !strings.Contains(w.Body.String(), "/v1/route/users/") {
+		t.Errorf("api detail should use the api path prefix: %s", w.Body.String())
+	}
+}
+
+func TestDuplicateRoute(t *testing.T) {
+	RegisterAPI("route", "dup1", "dup", routeHandler{}, Route(http.MethodGet, "/route/dup/:id"))
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("duplicate route should panic")
+		}
+	}()
+	RegisterAPI("route", "dup2", "dup", routeHandler{}, Route(http.MethodGet, "/route/dup/:name"))
+}
@@ -33,10 +33,16 @@ func WithSignCheckHandler(h *SignCheckHandler) Option {
 
 type SignCheckHandlerV2 struct {
 	signCheck func(u *url.URL, headers http.Header, body []byte) bool
+	// 内置的 HMAC 签名校验，见 NewHMACSignCheckHandler
+	hmac *hmacSignChecker
 }
 
+// CheckSign 内置的 HMAC 签名校验需要接口信息，只能在网关中完成，这里返回 false
 func (h *SignCheckHandlerV2) CheckSign(u *url.URL, headers http.Header, body []byte) bool {
 	// c.Request.Header
+	if h.signCheck == nil {
+		return false
+	}
 	return h.signCheck(u, headers, body)
 }
 
@@ -0,0 +1,262 @@
+package gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/xbonlinenet/goup/frame/log"
+)
+
+// 内置 HMAC 签名使用的请求头
+const (
+	HeaderAppKey    = "X-App-Key"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderNonce     = "X-Nonce"
+	HeaderSignature = "X-Signature"
+)
+
+var (
+	errSignMissing     = NewError(ErrInvalidSignature, "缺少签名参数").WithStatus(http.StatusBadRequest)
+	errSignInvalid     = NewError(ErrInvalidSignature, "非法签名").WithStatus(http.StatusBadRequest)
+	errSignExpired     = NewError(ErrExpiredRequest, "请求已经过期").WithStatus(http.StatusBadRequest)
+	errSignReplayed    = NewError(ErrExpiredRequest, "重复的请求").WithStatus(http.StatusBadRequest)
+	errSignAppKey      = NewError(ErrInvalidAppKey, "非法的appkey").WithStatus(http.StatusBadRequest)
+	errSignNotAuthed   = NewError(ErrAppNotAuthed, "App 未授权调用该接口").WithStatus(http.StatusForbidden)
+	errSignNonceFailed = NewError(ErrUnknowError, "签名校验异常").WithStatus(http.StatusInternalServerError)
+)
+
+// AppInfo 调用方的信息
+type AppInfo struct {
+	AppKey string `mapstructure:"key"`
+	Secret string `mapstructure:"secret"`
+	// APIs 允许调用的接口，支持 group.key、group.* 和 *，为空时不限制
+	APIs []string `mapstructure:"apis"`
+}
+
+// Allowed 是否允许调用接口
+func (app *AppInfo) Allowed(apiKey string) bool {
+	if len(app.APIs) == 0 {
+		return true
+	}
+	for _, pattern := range app.APIs {
+		if pattern == "*" || pattern == apiKey {
+			return true
+		}
+		if strings.HasSuffix(pattern, ".*") && strings.HasPrefix(apiKey, pattern[:len(pattern)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// AppStore 根据 appKey 获取调用方信息，appKey 不存在时返回 nil
+type AppStore interface {
+	GetApp(appKey string) (*AppInfo, error)
+}
+
+// configAppStore 从配置文件 gateway.sign.apps 中读取调用方信息
+//
+//	gateway:
+//	  sign:
+//	    apps:
+//	      - key: demo-app
+//	        secret: xxxx
+//	        apis: ["demo.*"]
+type configAppStore struct {
+	once sync.Once
+	apps map[string]*AppInfo
+	err  error
+}
+
+// NewConfigAppStore 从配置文件中读取调用方信息
+func NewConfigAppStore() AppStore {
+	return &configAppStore{}
+}
+
+func (s *configAppStore) GetApp(appKey string) (*AppInfo, error) {
+	s.once.Do(func() {
+		var apps []*AppInfo
+		s.err = viper.UnmarshalKey("gateway.sign.apps", &apps)
+		s.apps = make(map[string]*AppInfo, len(apps))
+		for _, app := range apps {
+			s.apps[app.AppKey] = app
+		}
+	})
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.apps[appKey], nil
+}
+
+// HMACSignConfig 内置 HMAC-SHA256 签名校验的配置
+type HMACSignConfig struct {
+	// Store 调用方信息，默认从配置文件中读取
+	Store AppStore
+	// NonceRedis 用于防重放的 redis 名称，为空时使用 data.redis.default；
+	// 两者都没有配置时不校验 nonce 是否重复，时间戳有效期内的请求可以被重放
+	NonceRedis string
+	// DisableNonceCheck 不校验 nonce 是否重复，时间戳有效期内的请求可以被重放
+	DisableNonceCheck bool
+}
+
+// hmacSignChecker 内置的签名校验
+type hmacSignChecker struct {
+	store        AppStore
+	nonceRedis   string
+	disableNonce bool
+}
+
+// signInfo 签名校验通过后的调用方信息
+type signInfo struct {
+	appKey    string
+	signature string
+	nonce     string
+	timestamp int64
+}
+
+// NewHMACSignCheckHandler 创建内置的 HMAC-SHA256 签名校验
+//
+// 客户端通过 X-App-Key、X-Timestamp (秒)、X-Nonce、X-Signature 请求头传递签名信息，
+// 签名的计算方式见 HMACSignature。时间戳超出接口的 Expired 时间，或者 nonce 被重复使用时请求会被拒绝，
+// nonce 的校验需要 Redis，见 HMACSignConfig.NonceRedis。
+func NewHMACSignCheckHandler(config HMACSignConfig) *SignCheckHandlerV2 {
+	store := config.Store
+	if store == nil {
+		store = NewConfigAppStore()
+	}
+
+	return &SignCheckHandlerV2{
+		hmac: &hmacSignChecker{
+			store:        store,
+			nonceRedis:   config.NonceRedis,
+			disableNonce: config.DisableNonceCheck,
+		},
+	}
+}
+
+// HMACSignature 计算签名，签名内容为以下各项以 \n 连接:
+// METHOD、PATH、按 key 排序后的 query、appKey、timestamp、nonce、hex(sha256(body))
+func HMACSignature(secret, method, path string, query url.Values, appKey, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+
+	canonical := strings.Join([]string{
+		strings.ToUpper(method),
+		path,
+		canonicalQuery(query),
+		appKey,
+		timestamp,
+		nonce,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(canonical))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// canonicalQuery 按 key 和 value 排序后编码
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	items := make([]string, 0, len(query))
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			items = append(items, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	return strings.Join(items, "&")
+}
+
+// nonceRedisName 防重放使用的 redis 名称，为空时不校验 nonce
+func (h *hmacSignChecker) nonceRedisName() string {
+	if h.disableNonce {
+		return ""
+	}
+	if h.nonceRedis != "" {
+		return h.nonceRedis
+	}
+	if viper.IsSet("data.redis.default") {
+		return "default"
+	}
+	return ""
+}
+
+// verify 校验签名、时间戳、nonce 以及接口权限
+func (h *hmacSignChecker) verify(r *http.Request, body []byte, apiKey string, expire time.Duration) (*signInfo, *Error) {
+	info := &signInfo{
+		appKey:    r.Header.Get(HeaderAppKey),
+		signature: r.Header.Get(HeaderSignature),
+		nonce:     r.Header.Get(HeaderNonce),
+	}
+	timestamp := r.Header.Get(HeaderTimestamp)
+	if info.appKey == "" || info.signature == "" || info.nonce == "" || timestamp == "" {
+		return nil, errSignMissing
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, errSignMissing
+	}
+	info.timestamp = ts
+
+	if diff := time.Since(time.Unix(ts, 0)); diff > expire || diff < -expire {
+		return nil, errSignExpired
+	}
+
+	app, err := h.store.GetApp(info.appKey)
+	if err != nil {
+		log.Default().Error("get app info error", zap.String("appKey", info.appKey), zap.Error(err))
+		return nil, errSignAppKey
+	}
+	if app == nil {
+		return nil, errSignAppKey
+	}
+
+	expected := HMACSignature(app.Secret, r.Method, r.URL.Path, r.URL.Query(), info.appKey, timestamp, info.nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(info.signature))) {
+		return nil, errSignInvalid
+	}
+
+	if !app.Allowed(apiKey) {
+		return nil, errSignNotAuthed
+	}
+
+	if name := h.nonceRedisName(); name != "" {
+		client, err := getRedis(name)
+		if err != nil {
+			log.Default().Error("get nonce redis error", zap.Error(err))
+			return nil, errSignNonceFailed
+		}
+
+		// 时间戳前后 expire 内的请求都可能通过校验，nonce 需要保留 2 倍的时间
+		key := fmt.Sprintf("goup:nonce:%s:%s", info.appKey, info.nonce)
+		ok, err := client.SetNX(key, 1, 2*expire).Result()
+		if err != nil {
+			log.Default().Error("check nonce error", zap.Error(err))
+			return nil, errSignNonceFailed
+		}
+		if !ok {
+			return nil, errSignReplayed
+		}
+	}
+
+	return info, nil
+}
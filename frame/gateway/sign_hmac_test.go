@@ -0,0 +1,106 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/xbonlinenet/goup/frame/data"
+)
+
+type staticAppStore map[string]*AppInfo
+
+func (s staticAppStore) GetApp(appKey string) (*AppInfo, error) {
+	return s[appKey], nil
+}
+
+func TestHMACSignCheck(t *testing.T) {
+	checker := NewHMACSignCheckHandler(HMACSignConfig{
+		Store: staticAppStore{
+			"app": {AppKey: "app", Secret: "secret", APIs: []string{"demo.*"}},
+		},
+	}).hmac
+
+	newRequest := func(appKey, secret string, ts time.Time, body []byte) *http.Request {
+		r, _ := http.NewRequest(http.MethodPost, "http://localhost/api/demo/echo?b=2&a=1", nil)
+		timestamp := strconv.FormatInt(ts.Unix(), 10)
+		r.Header.Set(HeaderAppKey, appKey)
+		r.Header.Set(HeaderTimestamp, timestamp)
+		r.Header.Set(HeaderNonce, "nonce")
+		r.Header.Set(HeaderSignature, HMACSignature(secret, r.Method, r.URL.Path, r.URL.Query(), appKey, timestamp, "nonce", body))
+		return r
+	}
+
+	body := []byte(`{"message":"hello"}`)
+	tests := []struct {
+		name     string
+		r        *http.Request
+		body     []byte
+		apiKey   string
+		wantCode int
+	}{
+		{"valid", newRequest("app", "secret", time.Now(), body), body, "demo.echo", ErrOK},
+		{"body modified", newRequest("app", "secret", time.Now(), body), []byte(`{}`), "demo.echo", ErrInvalidSignature},
+		{"wrong secret", newRequest("app", "wrong", time.Now(), body), body, "demo.echo", ErrInvalidSignature},
+		{"unknown app", newRequest("other", "secret", time.Now(), body), body, "demo.echo", ErrInvalidAppKey},
+		{"expired", newRequest("app", "secret", time.Now().Add(-time.Hour), body), body, "demo.echo", ErrExpiredRequest},
+		{"not authed", newRequest("app", "secret", time.Now(), body), body, "admin.echo", ErrAppNotAuthed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := checker.verify(tt.r, tt.body, tt.apiKey, 10*time.Minute)
+			code := ErrOK
+			if err != nil {
+				code = err.Code()
+			}
+			if code != tt.wantCode {
+				t.Errorf("verify() code = %d, want %d", code, tt.wantCode)
+			}
+			if err == nil && info.appKey != "app" {
+				t.Errorf("verify() appKey = %s", info.appKey)
+			}
+		})
+	}
+}
+
+func TestHMACNonceCheck(t *testing.T) {
+	server := newFakeRedis(t)
+	viper.Set("data.redis.default.addr", server.listener.Addr().String())
+	data.InitRedisMgr(map[string]*data.RedisConfig{})
+	defer func() {
+		data.UninitRedisMgr()
+		viper.Set("data.redis", nil)
+	}()
+
+	store := staticAppStore{"app": {AppKey: "app", Secret: "secret", APIs: []string{"demo.*"}}}
+	verify := func(checker *hmacSignChecker, nonce string) int {
+		r, _ := http.NewRequest(http.MethodPost, "http://localhost/api/demo/echo", nil)
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		r.Header.Set(HeaderAppKey, "app")
+		r.Header.Set(HeaderTimestamp, timestamp)
+		r.Header.Set(HeaderNonce, nonce)
+		r.Header.Set(HeaderSignature, HMACSignature("secret", r.Method, r.URL.Path, r.URL.Query(), "app", timestamp, nonce, nil))
+		if _, err := checker.verify(r, nil, "demo.echo", time.Minute); err != nil {
+			return err.Code()
+		}
+		return ErrOK
+	}
+
+	// 配置了 default 时默认校验 nonce
+	checker := NewHMACSignCheckHandler(HMACSignConfig{Store: store}).hmac
+	if code := verify(checker, "n1"); code != ErrOK {
+		t.Fatalf("first request code = %d", code)
+	}
+	if code := verify(checker, "n1"); code != ErrExpiredRequest {
+		t.Fatalf("replayed request code = %d, want %d", code, ErrExpiredRequest)
+	}
+
+	// 关闭后不再校验
+	checker = NewHMACSignCheckHandler(HMACSignConfig{Store: store, DisableNonceCheck: true}).hmac
+	if code := verify(checker, "n1"); code != ErrOK {
+		t.Fatalf("nonce check should be disabled, code = %d", code)
+	}
+}
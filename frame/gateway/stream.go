@@ -0,0 +1,234 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultStreamHeartbeat 流式响应默认的心跳间隔
+const defaultStreamHeartbeat = 15 * time.Second
+
+// StreamIterator 流式响应的迭代器，没有更多数据时 Next 返回 io.EOF
+type StreamIterator interface {
+	Next(ctx context.Context) (interface{}, error)
+}
+
+// SSEvent 自定义 SSE 事件的 id、event 和 retry，NDJSON 中只输出 Data
+type SSEvent struct {
+	ID    string
+	Event string
+	// Retry 客户端重连的间隔
+	Retry time.Duration
+	Data  interface{}
+}
+
+// StreamHeartbeat 流式响应的心跳间隔，默认 15 秒，避免代理因为空闲断开连接
+func StreamHeartbeat(d time.Duration) Option {
+	return optionFunc(func(handler *HandlerInfo) {
+		handler.heartbeat = d
+	})
+}
+
+// isStreamType 流式响应的类型，Handler 需要返回 channel 或者 StreamIterator
+func isStreamType(t respType) bool {
+	return t == SSEType || t == NDJSONType
+}
+
+type streamItem struct {
+	data interface{}
+	err  error
+}
+
+// openStream 将 Handler 返回的 channel 或者 StreamIterator 转换为 streamItem，ctx 取消后停止读取
+func openStream(ctx context.Context, response interface{}) (<-chan streamItem, error) {
+	items := make(chan streamItem)
+
+	if it, ok := response.(StreamIterator); ok {
+		go func() {
+			defer close(items)
+			for {
+				data, err := it.Next(ctx)
+				if err == io.EOF {
+					return
+				}
+				select {
+				case items <- streamItem{data: data, err: err}:
+				case <-ctx.Done():
+					return
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+		return items, nil
+	}
+
+	ch := reflect.Indirect(reflect.ValueOf(response))
+	if ch.Kind() != reflect.Chan || ch.Type().ChanDir()&reflect.RecvDir == 0 {
+		return nil, fmt.Errorf("stream response must be a channel or StreamIterator, got %T", response)
+	}
+
+	go func() {
+		defer close(items)
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: ch},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		}
+		for {
+			chosen, v, ok := reflect.Select(cases)
+			if chosen == 1 || !ok {
+				return
+			}
+
+			item := streamItem{data: v.Interface()}
+			// channel 中的 error 表示流异常结束
+			if err, isErr := item.data.(error); isErr {
+				item = streamItem{err: err}
+			}
+			select {
+			case items <- item:
+			case <-ctx.Done():
+				return
+			}
+			if item.err != nil {
+				return
+			}
+		}
+	}()
+	return items, nil
+}
+
+// writeStream 写入 SSE 或者 NDJSON 响应，直到数据结束、出错或者客户端断开，返回写入的事件数
+func writeStream(ctx context.Context, c *gin.Context, typ respType, heartbeat time.Duration, response interface{}) (int, error) {
+	items, err := openStream(ctx, response)
+	if err != nil {
+		panic(err)
+	}
+
+	header := c.Writer.Header()
+	if typ == SSEType {
+		header.Set("Content-Type", "text/event-stream; charset=utf-8")
+	} else {
+		header.Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	}
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// 关闭 nginx 的缓冲
+	header.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	if heartbeat <= 0 {
+		heartbeat = defaultStreamHeartbeat
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	count := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return count, ctx.Err()
+
+		case <-ticker.C:
+			ping := "\n"
+			if typ == SSEType {
+				ping = ": ping\n\n"
+			}
+			if _, err := io.WriteString(c.Writer, ping); err != nil {
+				return count, err
+			}
+			c.Writer.Flush()
+
+		case item, ok := <-items:
+			if !ok {
+				// ctx 结束时 openStream 也会关闭 items，此时不是正常结束
+				return count, ctx.Err()
+			}
+
+			var chunk string
+			if item.err != nil {
+				chunk, err = streamErrorChunk(typ, item.err)
+			} else {
+				chunk, err = streamChunk(typ, item.data)
+			}
+			if err != nil {
+				return count, err
+			}
+			if _, err := io.WriteString(c.Writer, chunk); err != nil {
+				return count, err
+			}
+			c.Writer.Flush()
+
+			if item.err != nil {
+				return count, item.err
+			}
+			count++
+		}
+	}
+}
+
+// streamChunk 单个事件的内容，字符串原样输出，其他类型编码为 json
+func streamChunk(typ respType, data interface{}) (string, error) {
+	event := SSEvent{Data: data}
+	switch e := data.(type) {
+	case SSEvent:
+		event = e
+	case *SSEvent:
+		event = *e
+	}
+
+	var payload string
+	if s, ok := event.Data.(string); ok && typ == SSEType {
+		payload = s
+	} else {
+		b, err := json.Marshal(event.Data)
+		if err != nil {
+			return "", err
+		}
+		payload = string(b)
+	}
+
+	if typ == NDJSONType {
+		return payload + "\n", nil
+	}
+
+	sb := strings.Builder{}
+	if event.ID != "" {
+		sb.WriteString("id: " + event.ID + "\n")
+	}
+	if event.Event != "" {
+		sb.WriteString("event: " + event.Event + "\n")
+	}
+	if event.Retry > 0 {
+		sb.WriteString(fmt.Sprintf("retry: %d\n", event.Retry.Milliseconds()))
+	}
+	for _, line := range strings.Split(payload, "\n") {
+		sb.WriteString("data: " + line + "\n")
+	}
+	sb.WriteString("\n")
+	return sb.String(), nil
+}
+
+// streamErrorChunk 流异常结束时输出错误，SSE 使用 error 事件
+func streamErrorChunk(typ respType, err error) (string, error) {
+	_, resp := errorResp(err)
+	if typ == SSEType {
+		return streamChunk(typ, SSEvent{Event: "error", Data: resp})
+	}
+	return streamChunk(typ, resp)
+}
+
+// isClientGone 客户端断开导致的流结束不算错误
+func isClientGone(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
@@ -0,0 +1,111 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type streamToken struct {
+	Text string `json:"text"`
+}
+
+type sliceIterator struct {
+	items []interface{}
+	err   error
+}
+
+func (it *sliceIterator) Next(ctx context.Context) (interface{}, error) {
+	if len(it.items) == 0 {
+		if it.err != nil {
+			return nil, it.err
+		}
+		return nil, io.EOF
+	}
+	item := it.items[0]
+	it.items = it.items[1:]
+	return item, nil
+}
+
+func TestWriteStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tokens := func(items ...interface{}) <-chan interface{} {
+		ch := make(chan interface{}, len(items))
+		for _, item := range items {
+			ch <- item
+		}
+		close(ch)
+		return ch
+	}
+
+	tests := []struct {
+		name     string
+		typ      respType
+		response interface{}
+		want     string
+		count    int
+		err      error
+	}{
+		{
+			name:     "sse channel",
+			typ:      SSEType,
+			response: tokens(streamToken{Text: "hello"}, "raw\ntext", SSEvent{ID: "3", Event: "done", Data: "bye"}),
+			want:     "data: {\"text\":\"hello\"}\n\ndata: raw\ndata: text\n\nid: 3\nevent: done\ndata: bye\n\n",
+			count:    3,
+		},
+		{
+			name:     "ndjson iterator",
+			typ:      NDJSONType,
+			response: &sliceIterator{items: []interface{}{streamToken{Text: "a"}, streamToken{Text: "b"}}},
+			want:     "{\"text\":\"a\"}\n{\"text\":\"b\"}\n",
+			count:    2,
+		},
+		{
+			name:     "sse error",
+			typ:      SSEType,
+			response: tokens(streamToken{Text: "a"}, NewError(1001, "quota exceeded")),
+			want:     "data: {\"text\":\"a\"}\n\nevent: error\ndata: {\"code\":1001,\"message\":\"quota exceeded\"}\n\n",
+			count:    1,
+			err:      NewError(1001, ""),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			count, err := writeStream(context.Background(), c, tt.typ, time.Minute, tt.response)
+			if count != tt.count || !errors.Is(err, tt.err) {
+				t.Errorf("writeStream() = %d, %v", count, err)
+			}
+			if w.Body.String() != tt.want {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteStreamClientGone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan streamToken)
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	count, err := writeStream(ctx, c, SSEType, 10*time.Millisecond, ch)
+	if count != 0 || !isClientGone(err) {
+		t.Errorf("writeStream() = %d, %v", count, err)
+	}
+	if w.Header().Get("Content-Type") != "text/event-stream; charset=utf-8" || w.Body.String()[:9] != ": ping\n\n:" {
+		t.Errorf("heartbeat not written: %q", w.Body.String())
+	}
+}
@@ -0,0 +1,176 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultUploadMemory 上传文件默认使用的内存，超过后写入临时文件
+const defaultUploadMemory = 32 << 20
+
+var (
+	fileHeaderType = reflect.TypeOf(&multipart.FileHeader{})
+
+	errBodyTooLarge = errors.New("request body too large")
+
+	errUploadTooLarge = NewError(ErrInvalidParam, "上传文件过大").WithStatus(http.StatusRequestEntityTooLarge)
+	errUploadTooMany  = NewError(ErrInvalidParam, "上传文件数量过多").WithStatus(http.StatusBadRequest)
+	errUploadType     = NewError(ErrInvalidParam, "不支持的文件类型").WithStatus(http.StatusUnsupportedMediaType)
+)
+
+// isFileType *multipart.FileHeader 或者 []*multipart.FileHeader
+func isFileType(t reflect.Type) bool {
+	return t == fileHeaderType || (t.Kind() == reflect.Slice && t.Elem() == fileHeaderType)
+}
+
+// UploadLimit 文件上传的限制，为 0 时不限制
+type UploadLimit struct {
+	// MaxFileSize 单个文件的最大字节数
+	MaxFileSize int64
+	// MaxRequestSize 请求体的最大字节数，超过后不再继续读取
+	MaxRequestSize int64
+	// MaxFiles 文件的最大数量
+	MaxFiles int
+	// AllowedTypes 允许的 MIME 类型，支持 image/* 的形式，类型根据文件内容检测
+	AllowedTypes []string
+	// MaxMemory 文件保存在内存中的最大字节数，超过后写入临时目录 (os.TempDir)，默认 32MB
+	MaxMemory int64
+}
+
+// Upload 设置接口的文件上传限制，限制在 Handler 和 PreHandler 执行前检查
+//
+// Request 中 *multipart.FileHeader、[]*multipart.FileHeader 类型的字段通过 form tag 绑定上传的文件
+func Upload(limit UploadLimit) Option {
+	return optionFunc(func(handler *HandlerInfo) {
+		handler.upload = &limit
+	})
+}
+
+func (l *UploadLimit) maxMemory() int64 {
+	if l == nil || l.MaxMemory <= 0 {
+		return defaultUploadMemory
+	}
+	return l.MaxMemory
+}
+
+// check 检查上传文件的大小、数量和类型
+func (l *UploadLimit) check(form *multipart.Form) *Error {
+	if form == nil {
+		return nil
+	}
+
+	count := 0
+	for _, files := range form.File {
+		for _, file := range files {
+			count++
+			if l.MaxFiles > 0 && count > l.MaxFiles {
+				return errUploadTooMany.WithMessage(fmt.Sprintf("最多上传%d个文件", l.MaxFiles))
+			}
+			if l.MaxFileSize > 0 && file.Size > l.MaxFileSize {
+				return errUploadTooLarge.WithMessage(fmt.Sprintf("%s 超过%d字节", file.Filename, l.MaxFileSize))
+			}
+			if len(l.AllowedTypes) > 0 {
+				contentType, err := detectContentType(file)
+				if err != nil {
+					return errUploadType.Wrap(err)
+				}
+				if !mimeTypeAllowed(contentType, l.AllowedTypes) {
+					return errUploadType.WithMessage(fmt.Sprintf("%s 的类型 %s 不支持", file.Filename, contentType))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// detectContentType 根据文件内容检测 MIME 类型，不信任客户端传递的 Content-Type
+func detectContentType(file *multipart.FileHeader) (string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	contentType, _, err := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	return contentType, err
+}
+
+func mimeTypeAllowed(contentType string, allowed []string) bool {
+	for _, t := range allowed {
+		if t == contentType {
+			return true
+		}
+		if strings.HasSuffix(t, "/*") && strings.HasPrefix(contentType, t[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// limitedBody 限制请求体的大小，超过后返回 errBodyTooLarge
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, errBodyTooLarge
+	}
+	// 多读一个字节判断是否超过限制
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n + int(b.remaining), errBodyTooLarge
+	}
+	return n, err
+}
+
+// limitRequestBody 限制请求体的大小，需要在读取 body 之前调用
+func limitRequestBody(c *gin.Context, n int64) {
+	if c.Request.Body == nil || c.Request.Body == http.NoBody {
+		return
+	}
+	c.Request.Body = &limitedBody{ReadCloser: c.Request.Body, remaining: n}
+}
+
+// SaveUploadedFile 保存上传的文件
+func SaveUploadedFile(file *multipart.FileHeader, dst string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, src)
+	return err
+}
@@ -0,0 +1,114 @@
+package gateway
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type uploadRequest struct {
+	Name        string                  `form:"name" binding:"required"`
+	Avatar      *multipart.FileHeader   `form:"avatar" binding:"required"`
+	Attachments []*multipart.FileHeader `form:"attachments"`
+}
+
+// 最小的 png 文件头
+var pngContent = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestUpload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type file struct {
+		field   string
+		content []byte
+	}
+	tests := []struct {
+		name    string
+		limit   UploadLimit
+		files   []file
+		status  int
+		bodyErr bool
+	}{
+		{
+			name:  "ok",
+			limit: UploadLimit{MaxFiles: 2, MaxFileSize: 1024, AllowedTypes: []string{"image/*"}},
+			files: []file{{"avatar", pngContent}, {"attachments", pngContent}},
+		},
+		{
+			name:   "too many files",
+			limit:  UploadLimit{MaxFiles: 1},
+			files:  []file{{"avatar", pngContent}, {"attachments", pngContent}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "file too large",
+			limit:  UploadLimit{MaxFileSize: 4},
+			files:  []file{{"avatar", pngContent}},
+			status: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:   "type not allowed",
+			limit:  UploadLimit{AllowedTypes: []string{"image/png"}},
+			files:  []file{{"avatar", []byte("plain text")}},
+			status: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:    "request too large",
+			limit:   UploadLimit{MaxRequestSize: 64},
+			files:   []file{{"avatar", bytes.Repeat([]byte("x"), 1024)}},
+			bodyErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			writer.WriteField("name", "test")
+			for _, f := range tt.files {
+				w, _ := writer.CreateFormFile(f.field, f.field+".bin")
+				w.Write(f.content)
+			}
+			writer.Close()
+
+			info := &HandlerInfo{reqType: reflect.TypeOf(uploadRequest{}), sources: newRequestSources(reflect.TypeOf(uploadRequest{}))}
+			Upload(tt.limit).apply(info)
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request, _ = http.NewRequest(http.MethodPost, "/api/upload", body)
+			c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+			if tt.limit.MaxRequestSize > 0 {
+				limitRequestBody(c, tt.limit.MaxRequestSize)
+			}
+
+			var req uploadRequest
+			_, err := bindRequest(c, info, &req, nil)
+			if tt.bodyErr {
+				if !errors.Is(err, errBodyTooLarge) {
+					t.Fatalf("err = %v, want errBodyTooLarge", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if req.Name != "test" || req.Avatar == nil {
+				t.Fatalf("files not bound: %+v", req)
+			}
+
+			uploadErr := info.upload.check(c.Request.MultipartForm)
+			status := 0
+			if uploadErr != nil {
+				status = uploadErr.HTTPStatus()
+			}
+			if status != tt.status {
+				t.Errorf("status = %d, want %d (%v)", status, tt.status, uploadErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package gateway
+
+import (
+	stdjson "encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError 单个字段的校验错误
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+var (
+	// validationMessages 校验规则的错误提示，language -> rule -> message
+	// message 中的 {field}、{param}、{rule} 会被替换
+	validationMessages = map[string]map[string]string{
+		"zh": {
+			"required": "{field}为必填字段",
+			"min":      "{field}不能小于{param}",
+			"max":      "{field}不能大于{param}",
+			"len":      "{field}长度必须为{param}",
+			"eq":       "{field}必须等于{param}",
+			"ne":       "{field}不能等于{param}",
+			"gt":       "{field}必须大于{param}",
+			"gte":      "{field}必须大于或等于{param}",
+			"lt":       "{field}必须小于{param}",
+			"lte":      "{field}必须小于或等于{param}",
+			"oneof":    "{field}必须是[{param}]中的一个",
+			"email":    "{field}必须是有效的邮箱地址",
+			"url":      "{field}必须是有效的URL",
+			"numeric":  "{field}必须是数字",
+			"type":     "{field}类型错误，应为{param}",
+			"":         "{field}校验失败({rule})",
+		},
+		"en": {
+			"required": "{field} is required",
+			"min":      "{field} must be at least {param}",
+			"max":      "{field} must be at most {param}",
+			"len":      "{field} must have length {param}",
+			"eq":       "{field} must be equal to {param}",
+			"ne":       "{field} must not be equal to {param}",
+			"gt":       "{field} must be greater than {param}",
+			"gte":      "{field} must be greater than or equal to {param}",
+			"lt":       "{field} must be less than {param}",
+			"lte":      "{field} must be less than or equal to {param}",
+			"oneof":    "{field} must be one of [{param}]",
+			"email":    "{field} must be a valid email address",
+			"url":      "{field} must be a valid URL",
+			"numeric":  "{field} must be numeric",
+			"type":     "{field} must be of type {param}",
+			"":         "{field} failed on the '{rule}' rule",
+		},
+	}
+	defaultValidationLanguage = "zh"
+	validationMu              sync.RWMutex
+)
+
+// RegisterValidation 注册自定义的校验规则，可以在 binding tag 中使用
+func RegisterValidation(rule string, fn validator.Func) error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("binding validator isn't go-playground/validator")
+	}
+	return v.RegisterValidation(rule, fn)
+}
+
+// RegisterValidationMessage 设置校验规则在某种语言下的错误提示
+// message 中可以使用 {field}、{param}、{rule} 占位符
+func RegisterValidationMessage(language, rule, message string) {
+	validationMu.Lock()
+	defer validationMu.Unlock()
+
+	language = strings.ToLower(language)
+	if _, ok := validationMessages[language]; !ok {
+		validationMessages[language] = map[string]string{}
+	}
+	validationMessages[language][rule] = message
+}
+
+// SetDefaultValidationLanguage 请求未指定 Accept-Language 或者语言不支持时使用的语言
+func SetDefaultValidationLanguage(language string) {
+	validationMu.Lock()
+	defer validationMu.Unlock()
+
+	defaultValidationLanguage = strings.ToLower(language)
+}
+
+// bindingFieldErrors 将绑定错误转换成字段级别的错误，tag 为字段名使用的 tag (json/form)
+func bindingFieldErrors(c *gin.Context, reqType reflect.Type, tag string, err error) []*FieldError {
+	language := validationLanguage(c.GetHeader("Accept-Language"))
+
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make([]*FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			field := fieldPath(reqType, fe.StructNamespace(), tag)
+			fields = append(fields, &FieldError{
+				Field:   field,
+				Rule:    fe.Tag(),
+				Param:   fe.Param(),
+				Message: validationMessage(language, fe.Tag(), field, fe.Param()),
+			})
+		}
+		return fields
+	}
+
+	var typeErr *stdjson.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		param := typeErr.Type.String()
+		return []*FieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Param:   param,
+			Message: validationMessage(language, "type", typeErr.Field, param),
+		}}
+	}
+
+	return nil
+}
+
+// validationLanguage 根据 Accept-Language 选择语言, 如 zh-CN,zh;q=0.9 => zh-cn 或者 zh
+func validationLanguage(acceptLanguage string) string {
+	validationMu.RLock()
+	defer validationMu.RUnlock()
+
+	for _, item := range strings.Split(acceptLanguage, ",") {
+		lang := strings.ToLower(strings.TrimSpace(strings.Split(item, ";")[0]))
+		if lang == "" {
+			continue
+		}
+		if _, ok := validationMessages[lang]; ok {
+			return lang
+		}
+		if i := strings.Index(lang, "-"); i > 0 {
+			if _, ok := validationMessages[lang[:i]]; ok {
+				return lang[:i]
+			}
+		}
+	}
+	return defaultValidationLanguage
+}
+
+func validationMessage(language, rule, field, param string) string {
+	validationMu.RLock()
+	defer validationMu.RUnlock()
+
+	messages := validationMessages[language]
+	message, ok := messages[rule]
+	if !ok {
+		message, ok = validationMessages[defaultValidationLanguage][rule]
+	}
+	if !ok {
+		message = messages[""]
+	}
+	if message == "" {
+		message = validationMessages["en"][""]
+	}
+
+	return strings.NewReplacer("{field}", field, "{param}", param, "{rule}", rule).Replace(message)
+}
+
+// fieldPath 将 validator 的 StructNamespace (如 DocRequest.Array[0].Hello) 转换为请求中的字段路径 (如 array[0].hello)
+func fieldPath(reqType reflect.Type, namespace string, tag string) string {
+	segments := strings.Split(namespace, ".")
+	if len(segments) > 1 {
+		// 第一段是结构体的名称
+		segments = segments[1:]
+	}
+
+	t := reqType
+	path := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		name, index := segment, ""
+		if i := strings.Index(segment, "["); i > 0 {
+			name, index = segment[:i], segment[i:]
+		}
+
+		for t != nil && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		if t == nil || t.Kind() != reflect.Struct {
+			path = append(path, segment)
+			t = nil
+			continue
+		}
+
+		field, ok := t.FieldByName(name)
+		if !ok {
+			path = append(path, segment)
+			t = nil
+			continue
+		}
+
+		t = field.Type
+		fieldName := strings.Split(field.Tag.Get(tag), ",")[0]
+		if fieldName == "" && tag == "msgpack" {
+			// msgpack 没有 tag 时使用 json tag
+			fieldName = strings.Split(field.Tag.Get("json"), ",")[0]
+		}
+		// header、path 等来源的字段使用对应 tag 中的名称
+		switch source := fieldSource(field); source {
+		case sourcePath, sourceHeader, sourceCookie:
+			fieldName = tagName(field, source)
+		case sourceQuery:
+			fieldName = tagName(field, "form")
+		}
+		if field.Anonymous && fieldName == "" {
+			// 匿名嵌入的结构体，字段会被展开
+			continue
+		}
+		if fieldName == "" || fieldName == "-" {
+			fieldName = field.Name
+		}
+		path = append(path, fieldName+index)
+
+		// 每一个下标都是一层 slice/array/map
+		for i := strings.Count(index, "["); i > 0; i-- {
+			for t.Kind() == reflect.Ptr {
+				t = t.Elem()
+			}
+			if t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+				t = t.Elem()
+			}
+		}
+	}
+
+	return strings.Join(path, ".")
+}
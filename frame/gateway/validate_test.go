@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+type validateBase struct {
+	UserId string `json:"userId" binding:"required"`
+}
+
+type validateItem struct {
+	Hello string `json:"hello" binding:"required"`
+}
+
+type validateRequest struct {
+	validateBase
+	Message string          `json:"message" binding:"required"`
+	Count   int             `json:"count" binding:"gte=1,lte=10"`
+	Items   []*validateItem `json:"items" binding:"dive"`
+}
+
+func TestBindingFieldErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		body     string
+		language string
+		want     []*FieldError
+	}{
+		{
+			name:     "validation errors use json names",
+			body:     `{"count": 11, "items": [{"hello": "x"}, {}]}`,
+			language: "en-US,en;q=0.9",
+			want: []*FieldError{
+				{Field: "userId", Rule: "required", Message: "userId is required"},
+				{Field: "message", Rule: "required", Message: "message is required"},
+				{Field: "count", Rule: "lte", Param: "10", Message: "count must be less than or equal to 10"},
+				{Field: "items[1].hello", Rule: "required", Message: "items[1].hello is required"},
+			},
+		},
+		{
+			name: "type error",
+			body: `{"userId": "1", "message": "hi", "count": "one"}`,
+			want: []*FieldError{
+				{Field: "count", Rule: "type", Param: "int", Message: "count类型错误，应为int"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request, _ = http.NewRequest(http.MethodPost, "/", bytes.NewBufferString(tt.body))
+			c.Request.Header.Set("Accept-Language", tt.language)
+
+			var req validateRequest
+			err := c.ShouldBindBodyWith(&req, binding.JSON)
+			if err == nil {
+				t.Fatalf("binding should fail")
+			}
+
+			got := bindingFieldErrors(c, reflect.TypeOf(req), "json", err)
+			if !reflect.DeepEqual(got, tt.want) {
+				for _, f := range got {
+					t.Logf("got %+v", f)
+				}
+				t.Errorf("bindingFieldErrors() mismatch")
+			}
+		})
+	}
+}
+
+func TestRegisterValidationMessage(t *testing.T) {
+	RegisterValidationMessage("vi", "required", "{field} là bắt buộc")
+
+	if lang := validationLanguage("vi-VN"); lang != "vi" {
+		t.Errorf("validationLanguage() = %s", lang)
+	}
+	if msg := validationMessage("vi", "required", "name", ""); msg != "name là bắt buộc" {
+		t.Errorf("validationMessage() = %s", msg)
+	}
+	// 未翻译的规则使用默认语言
+	if msg := validationMessage("vi", "max", "name", "3"); msg != "name不能大于3" {
+		t.Errorf("validationMessage() = %s", msg)
+	}
+}
@@ -0,0 +1,388 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/xbonlinenet/goup/frame/log"
+	"go.uber.org/zap"
+)
+
+// WebSocket 连接的默认参数
+const (
+	defaultWSSendBuffer     = 64
+	defaultWSPingInterval   = 30 * time.Second
+	defaultWSWriteWait      = 10 * time.Second
+	defaultWSMaxMessageSize = 64 << 10
+)
+
+var (
+	errWSClosed      = errors.New("websocket connection closed")
+	errWSSendTimeout = errors.New("websocket send buffer is full")
+)
+
+// WebSocketHandler 处理 WebSocket 连接，返回后连接关闭
+type WebSocketHandler func(c *ApiContext, conn *WSConn) error
+
+// WebSocketConfig WebSocket 连接的参数，为 0 时使用默认值
+type WebSocketConfig struct {
+	// SendBuffer 发送队列的长度，默认 64
+	SendBuffer int
+	// PingInterval 发送 ping 的间隔，默认 30 秒
+	PingInterval time.Duration
+	// PongWait 等待 pong 或者其他消息的时间，超过后断开连接，默认是 PingInterval 的两倍
+	PongWait time.Duration
+	// WriteWait 单条消息写入的超时时间，也是发送队列满时 WriteMessage 等待的时间，默认 10 秒
+	WriteWait time.Duration
+	// MaxMessageSize 读取消息的最大字节数，默认 64KB
+	MaxMessageSize int64
+
+	ReadBufferSize  int
+	WriteBufferSize int
+}
+
+// WebSocket 设置 WebSocket 连接的参数，只对 RegisterWebSocket 注册的接口有效
+func WebSocket(config WebSocketConfig) Option {
+	return optionFunc(func(handler *HandlerInfo) {
+		handler.wsConfig = &config
+	})
+}
+
+func (c *WebSocketConfig) withDefaults() WebSocketConfig {
+	config := WebSocketConfig{}
+	if c != nil {
+		config = *c
+	}
+	if config.SendBuffer <= 0 {
+		config.SendBuffer = defaultWSSendBuffer
+	}
+	if config.PingInterval <= 0 {
+		config.PingInterval = defaultWSPingInterval
+	}
+	if config.PongWait <= config.PingInterval {
+		config.PongWait = config.PingInterval * 2
+	}
+	if config.WriteWait <= 0 {
+		config.WriteWait = defaultWSWriteWait
+	}
+	if config.MaxMessageSize <= 0 {
+		config.MaxMessageSize = defaultWSMaxMessageSize
+	}
+	return config
+}
+
+// RegisterWebSocket 注册 WebSocket 接口，握手请求和普通接口一样经过 CORS、签名校验和 PreHandler，
+// 全部通过后才升级连接。
+//
+//	gateway.RegisterWebSocket("chat", "room", "聊天室", func(c *gateway.ApiContext, conn *gateway.WSConn) error {
+//		hub.Join(c.UserID(), conn)
+//		for {
+//			var msg ChatMessage
+//			if err := conn.ReadJSON(&msg); err != nil {
+//				return err
+//			}
+//			hub.Broadcast(msg.Room, &msg)
+//		}
+//	}, gateway.JWTAuth(auth))
+//
+// 握手请求的参数从 query 中读取，设置 Timeout 时会限制连接的最长时间
+func RegisterWebSocket(group, key, name string, handler WebSocketHandler, opts ...Option) {
+	reqType := reflect.TypeOf(struct{}{})
+
+	// 握手请求没有 body
+	opts = append([]Option{optionFunc(func(info *HandlerInfo) {
+		info.pt = formType
+	})}, opts...)
+
+	registerHandler(group, key, name, reqType, reqType, &HandlerInfo{
+		newRequest: func() interface{} {
+			return &struct{}{}
+		},
+		call: func(apiContext *ApiContext, request interface{}) (interface{}, error) {
+			return nil, fmt.Errorf("%s.%s is a websocket api", group, key)
+		},
+		mock: func(request interface{}) interface{} {
+			return &struct{}{}
+		},
+		websocket: handler,
+	}, opts...)
+}
+
+// serveWebSocket 升级连接并调用 WebSocketHandler，返回连接的统计信息用于日志
+func serveWebSocket(c *gin.Context, info *HandlerInfo, apiContext *ApiContext) (string, error) {
+	config := info.wsConfig.withDefaults()
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  config.ReadBufferSize,
+		WriteBufferSize: config.WriteBufferSize,
+	}
+	// 配置了 CORS 时按 CORS 的规则检查 Origin，否则只允许同源
+	if info.corsHandler != nil {
+		upgrader.CheckOrigin = info.corsHandler.CheckOriginByRequest
+	}
+
+	header := http.Header{}
+	for key, val := range apiContext.respHeaders {
+		header.Set(key, val)
+	}
+
+	// 升级失败时 Upgrader 已经写入了错误响应
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, header)
+	if err != nil {
+		return "websocket: upgrade failed", err
+	}
+
+	conn := newWSConn(apiContext, ws, config)
+	apiContext.ws = conn
+	defer conn.Close()
+
+	err = info.websocket(apiContext, conn)
+	if errors.Is(err, errWSClosed) || websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+		err = nil
+	}
+	return fmt.Sprintf("websocket: %d received, %d sent", atomic.LoadInt64(&conn.received), atomic.LoadInt64(&conn.sent)), err
+}
+
+// wsFrame 发送队列中的消息，广播时使用 PreparedMessage 避免重复编码
+type wsFrame struct {
+	typ      int
+	data     []byte
+	prepared *websocket.PreparedMessage
+}
+
+// WSConn WebSocket 连接，读写都是并发安全的。
+//
+// 连接有独立的读写 goroutine：读 goroutine 处理 pong 和关闭帧，写 goroutine 发送队列中的消息和定时 ping。
+// 发送队列满时 WriteMessage 最多等待 WriteWait，Hub 广播时不等待，直接断开处理不过来的连接。
+type WSConn struct {
+	conn   *websocket.Conn
+	config WebSocketConfig
+
+	send chan wsFrame
+	recv chan wsFrame
+	// readErr 读取失败的原因，recv 关闭后可以读取
+	readErr error
+
+	ctx        context.Context
+	cancel     context.CancelFunc
+	writerDone chan struct{}
+	closeOnce  sync.Once
+
+	// groups 加入的 Hub 分组，连接关闭时退出
+	mu     sync.Mutex
+	groups map[*Hub]map[string]struct{}
+
+	received int64
+	sent     int64
+}
+
+func newWSConn(parent context.Context, ws *websocket.Conn, config WebSocketConfig) *WSConn {
+	ctx, cancel := context.WithCancel(parent)
+	c := &WSConn{
+		conn:       ws,
+		config:     config,
+		send:       make(chan wsFrame, config.SendBuffer),
+		recv:       make(chan wsFrame),
+		ctx:        ctx,
+		cancel:     cancel,
+		writerDone: make(chan struct{}),
+		groups:     map[*Hub]map[string]struct{}{},
+	}
+	go c.readPump()
+	go c.writePump()
+	return c
+}
+
+func (c *WSConn) readPump() {
+	defer close(c.recv)
+	defer c.cancel()
+
+	c.conn.SetReadLimit(c.config.MaxMessageSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(c.config.PongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(c.config.PongWait))
+	})
+
+	for {
+		typ, data, err := c.conn.ReadMessage()
+		if err != nil {
+			c.readErr = err
+			return
+		}
+		_ = c.conn.SetReadDeadline(time.Now().Add(c.config.PongWait))
+
+		select {
+		case c.recv <- wsFrame{typ: typ, data: data}:
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *WSConn) writePump() {
+	ticker := time.NewTicker(c.config.PingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+		close(c.writerDone)
+	}()
+
+	for {
+		select {
+		case frame := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(c.config.WriteWait))
+			var err error
+			if frame.prepared != nil {
+				err = c.conn.WritePreparedMessage(frame.prepared)
+			} else {
+				err = c.conn.WriteMessage(frame.typ, frame.data)
+			}
+			if err != nil {
+				c.cancel()
+				return
+			}
+			atomic.AddInt64(&c.sent, 1)
+
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.config.WriteWait)); err != nil {
+				c.cancel()
+				return
+			}
+
+		case <-c.ctx.Done():
+			msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+			_ = c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(c.config.WriteWait))
+			return
+		}
+	}
+}
+
+// Context 连接的 context，连接断开后被取消
+func (c *WSConn) Context() context.Context {
+	return c.ctx
+}
+
+// Done 连接断开后关闭
+func (c *WSConn) Done() <-chan struct{} {
+	return c.ctx.Done()
+}
+
+// ReadMessage 读取一条消息，连接断开后返回错误
+func (c *WSConn) ReadMessage() (int, []byte, error) {
+	frame, ok := <-c.recv
+	if !ok {
+		if c.readErr != nil {
+			return 0, nil, c.readErr
+		}
+		return 0, nil, errWSClosed
+	}
+	atomic.AddInt64(&c.received, 1)
+	return frame.typ, frame.data, nil
+}
+
+// ReadJSON 读取一条消息并解码到 v
+func (c *WSConn) ReadJSON(v interface{}) error {
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// WriteMessage 将消息放入发送队列，队列满时最多等待 WriteWait
+func (c *WSConn) WriteMessage(typ int, data []byte) error {
+	return c.enqueue(wsFrame{typ: typ, data: data})
+}
+
+// WriteJSON 将 v 编码为 json 文本消息放入发送队列
+func (c *WSConn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *WSConn) enqueue(frame wsFrame) error {
+	if c.ctx.Err() != nil {
+		return errWSClosed
+	}
+
+	select {
+	case c.send <- frame:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(c.config.WriteWait)
+	defer timer.Stop()
+	select {
+	case c.send <- frame:
+		return nil
+	case <-c.ctx.Done():
+		return errWSClosed
+	case <-timer.C:
+		return errWSSendTimeout
+	}
+}
+
+// trySend 广播使用，队列满时断开连接，避免一个慢连接拖慢整个分组
+func (c *WSConn) trySend(frame wsFrame) {
+	if c.ctx.Err() != nil {
+		return
+	}
+	select {
+	case c.send <- frame:
+	default:
+		log.Default().Warn("websocket send buffer is full, close slow connection",
+			zap.String("remote", c.conn.RemoteAddr().String()))
+		c.cancel()
+	}
+}
+
+// Close 关闭连接并退出所有 Hub 分组，可以重复调用
+func (c *WSConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.cancel()
+		<-c.writerDone
+
+		c.mu.Lock()
+		groups := c.groups
+		c.groups = map[*Hub]map[string]struct{}{}
+		c.mu.Unlock()
+
+		for hub, names := range groups {
+			for name := range names {
+				hub.remove(name, c)
+			}
+		}
+	})
+	return nil
+}
+
+func (c *WSConn) addGroup(hub *Hub, group string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.groups[hub] == nil {
+		c.groups[hub] = map[string]struct{}{}
+	}
+	c.groups[hub][group] = struct{}{}
+}
+
+func (c *WSConn) removeGroup(hub *Hub, group string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.groups[hub], group)
+}
+
+// WebSocket 获取 WebSocket 连接，非 WebSocket 接口返回 nil
+func (c *ApiContext) WebSocket() *WSConn {
+	return c.ws
+}
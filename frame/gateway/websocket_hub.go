@@ -0,0 +1,234 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/gorilla/websocket"
+	"github.com/xbonlinenet/goup/frame/data"
+	"github.com/xbonlinenet/goup/frame/log"
+	"go.uber.org/zap"
+)
+
+// Hub 将 WebSocket 连接按分组管理，向分组中的所有连接广播消息。
+//
+// NewHub 创建的 Hub 只在当前实例中广播，NewRedisHub 创建的 Hub 通过 Redis pub/sub 广播到所有实例
+type Hub struct {
+	name string
+	// redisName data.redis 下配置的名称，为空时只在当前实例中广播
+	redisName string
+
+	mu     sync.RWMutex
+	groups map[string]map[*WSConn]struct{}
+
+	// subMu 保护 pubsub 和 closed，订阅时需要访问 Redis，不使用 mu，避免阻塞广播
+	subMu  sync.Mutex
+	pubsub *redis.PubSub
+	closed bool
+}
+
+// hubSubscribeTimeout 等待 Redis 确认订阅的时间
+const hubSubscribeTimeout = 5 * time.Second
+
+var errHubClosed = errors.New("websocket hub closed")
+
+// hubMessage Redis 中广播的消息
+type hubMessage struct {
+	Group string `json:"group"`
+	Data  []byte `json:"data"`
+}
+
+// redisSubscriber redis.Client 和 redis.ClusterClient 都支持订阅
+type redisSubscriber interface {
+	Subscribe(channels ...string) *redis.PubSub
+}
+
+// NewHub 创建只在当前实例中广播的 Hub
+func NewHub() *Hub {
+	return &Hub{groups: map[string]map[*WSConn]struct{}{}}
+}
+
+// NewRedisHub 创建通过 Redis pub/sub 在多个实例间广播的 Hub，name 用于区分不同的 Hub，
+// redisName 为 data.redis 下配置的名称。首次加入分组时订阅 Redis，订阅失败时在之后的 Join、Broadcast 中重试，
+// 订阅成功之前广播的消息直接发送给当前实例中的连接
+func NewRedisHub(name, redisName string) *Hub {
+	h := NewHub()
+	h.name = name
+	h.redisName = redisName
+	return h
+}
+
+func (h *Hub) channel() string {
+	return "goup:ws:" + h.name
+}
+
+// Join 将连接加入分组，连接关闭时自动退出
+func (h *Hub) Join(group string, conn *WSConn) {
+	if h.redisName != "" {
+		if err := h.subscribe(); err != nil {
+			log.Default().Error("websocket hub subscribe failed", zap.String("hub", h.name), zap.Error(err))
+		}
+	}
+
+	conn.addGroup(h, group)
+
+	h.mu.Lock()
+	conns, ok := h.groups[group]
+	if !ok {
+		conns = map[*WSConn]struct{}{}
+		h.groups[group] = conns
+	}
+	conns[conn] = struct{}{}
+	h.mu.Unlock()
+
+	// 加入时连接已经关闭，Close 中可能没有看到这个分组
+	if conn.ctx.Err() != nil {
+		h.remove(group, conn)
+	}
+}
+
+// Leave 将连接移出分组
+func (h *Hub) Leave(group string, conn *WSConn) {
+	conn.removeGroup(h, group)
+	h.remove(group, conn)
+}
+
+func (h *Hub) remove(group string, conn *WSConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if conns, ok := h.groups[group]; ok {
+		delete(conns, conn)
+		if len(conns) == 0 {
+			delete(h.groups, group)
+		}
+	}
+}
+
+// Count 当前实例中分组的连接数
+func (h *Hub) Count(group string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.groups[group])
+}
+
+// Broadcast 将 v 编码为 json 后广播给分组中的所有连接，发送队列满的连接会被断开
+func (h *Hub) Broadcast(group string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if h.redisName == "" {
+		h.deliver(group, payload)
+		return nil
+	}
+
+	// 订阅成功时当前实例也通过订阅收到消息，这里不再直接发送
+	if err := h.subscribe(); err != nil {
+		log.Default().Error("websocket hub subscribe failed", zap.String("hub", h.name), zap.Error(err))
+		h.deliver(group, payload)
+	}
+
+	msg, err := json.Marshal(&hubMessage{Group: group, Data: payload})
+	if err != nil {
+		return err
+	}
+	client, err := h.redis()
+	if err != nil {
+		return err
+	}
+	return client.Publish(h.channel(), msg).Err()
+}
+
+func (h *Hub) redis() (redis.Cmdable, error) {
+	return getRedis(h.redisName)
+}
+
+// getRedis Redis 没有初始化时 data.GetRedis 会 panic，转换为错误
+func getRedis(name string) (client redis.Cmdable, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return data.GetRedis(name)
+}
+
+// deliver 发送给当前实例中分组的连接
+func (h *Hub) deliver(group string, payload []byte) {
+	h.mu.RLock()
+	conns := make([]*WSConn, 0, len(h.groups[group]))
+	for conn := range h.groups[group] {
+		conns = append(conns, conn)
+	}
+	h.mu.RUnlock()
+
+	if len(conns) == 0 {
+		return
+	}
+
+	prepared, err := websocket.NewPreparedMessage(websocket.TextMessage, payload)
+	if err != nil {
+		log.Default().Error("prepare websocket message failed", zap.Error(err))
+		return
+	}
+	for _, conn := range conns {
+		conn.trySend(wsFrame{prepared: prepared})
+	}
+}
+
+// subscribe 订阅 Redis 中的广播消息，已经订阅时直接返回。等待 Redis 确认订阅之后才返回，
+// 避免之后立即发布的消息丢失；连接断开后由 go-redis 自动重连
+func (h *Hub) subscribe() error {
+	h.subMu.Lock()
+	defer h.subMu.Unlock()
+	if h.closed {
+		return errHubClosed
+	}
+	if h.pubsub != nil {
+		return nil
+	}
+
+	client, err := h.redis()
+	if err != nil {
+		return err
+	}
+	subscriber, ok := client.(redisSubscriber)
+	if !ok {
+		return fmt.Errorf("redis %T does not support subscribe", client)
+	}
+
+	pubsub := subscriber.Subscribe(h.channel())
+	if _, err := pubsub.ReceiveTimeout(hubSubscribeTimeout); err != nil {
+		_ = pubsub.Close()
+		return err
+	}
+	h.pubsub = pubsub
+
+	ch := pubsub.Channel()
+	go func() {
+		for m := range ch {
+			var msg hubMessage
+			if err := json.Unmarshal([]byte(m.Payload), &msg); err != nil {
+				log.Default().Warn("invalid websocket hub message", zap.String("hub", h.name), zap.Error(err))
+				continue
+			}
+			h.deliver(msg.Group, msg.Data)
+		}
+	}()
+	return nil
+}
+
+// Close 取消 Redis 订阅，已加入的连接不受影响
+func (h *Hub) Close() error {
+	h.subMu.Lock()
+	defer h.subMu.Unlock()
+	h.closed = true
+	if h.pubsub != nil {
+		return h.pubsub.Close()
+	}
+	return nil
+}
@@ -0,0 +1,387 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
+
+	"github.com/xbonlinenet/goup/frame/data"
+)
+
+type wsTestMessage struct {
+	Text string `json:"text"`
+}
+
+// newWSTestServer 启动 WebSocket 服务，返回客户端连接
+func newWSTestServer(t *testing.T, config WebSocketConfig, handler func(conn *WSConn)) *websocket.Conn {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		conn := newWSConn(context.Background(), ws, config.withDefaults())
+		defer conn.Close()
+		handler(conn)
+	}))
+	t.Cleanup(server.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestWSConnReadWriteJSON(t *testing.T) {
+	closed := make(chan error, 1)
+	client := newWSTestServer(t, WebSocketConfig{}, func(conn *WSConn) {
+		for {
+			var msg wsTestMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				closed <- err
+				return
+			}
+			if err := conn.WriteJSON(&wsTestMessage{Text: "echo: " + msg.Text}); err != nil {
+				closed <- err
+				return
+			}
+		}
+	})
+
+	for _, text := range []string{"a", "b"} {
+		if err := client.WriteJSON(&wsTestMessage{Text: text}); err != nil {
+			t.Fatal(err)
+		}
+		var resp wsTestMessage
+		if err := client.ReadJSON(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Text != "echo: "+text {
+			t.Fatalf("got %q", resp.Text)
+		}
+	}
+
+	// 客户端断开后 ReadJSON 返回错误
+	client.Close()
+	select {
+	case err := <-closed:
+		if err == nil {
+			t.Fatal("expected read error after client closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler should return after client closed")
+	}
+}
+
+func TestWSConnPing(t *testing.T) {
+	client := newWSTestServer(t, WebSocketConfig{PingInterval: 20 * time.Millisecond}, func(conn *WSConn) {
+		<-conn.Done()
+	})
+
+	var pings int32
+	client.SetPingHandler(func(data string) error {
+		atomic.AddInt32(&pings, 1)
+		return client.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	// 读取消息时才会处理 ping
+	_ = client.SetReadDeadline(time.Now().Add(150 * time.Millisecond))
+	_, _, _ = client.ReadMessage()
+
+	if n := atomic.LoadInt32(&pings); n < 2 {
+		t.Fatalf("expected pings, got %d", n)
+	}
+}
+
+func TestWSConnBackpressure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	// 没有写 goroutine，发送队列不会被消费
+	conn := &WSConn{
+		config: WebSocketConfig{WriteWait: 20 * time.Millisecond},
+		send:   make(chan wsFrame, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("2")); err != errWSSendTimeout {
+		t.Fatalf("expected send timeout, got %v", err)
+	}
+
+	cancel()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("3")); err != errWSClosed {
+		t.Fatalf("expected closed, got %v", err)
+	}
+}
+
+func TestHubBroadcast(t *testing.T) {
+	hub := NewHub()
+	joined := make(chan *WSConn, 3)
+	handler := func(group string) func(conn *WSConn) {
+		return func(conn *WSConn) {
+			hub.Join(group, conn)
+			joined <- conn
+			<-conn.Done()
+		}
+	}
+
+	a1 := newWSTestServer(t, WebSocketConfig{}, handler("a"))
+	a2 := newWSTestServer(t, WebSocketConfig{}, handler("a"))
+	b := newWSTestServer(t, WebSocketConfig{}, handler("b"))
+	for i := 0; i < 3; i++ {
+		<-joined
+	}
+
+	if n := hub.Count("a"); n != 2 {
+		t.Fatalf("group a should have 2 connections, got %d", n)
+	}
+
+	if err := hub.Broadcast("a", &wsTestMessage{Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, client := range []*websocket.Conn{a1, a2} {
+		var msg wsTestMessage
+		_ = client.SetReadDeadline(time.Now().Add(time.Second))
+		if err := client.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Text != "hello" {
+			t.Fatalf("got %q", msg.Text)
+		}
+	}
+
+	// 其他分组收不到
+	_ = b.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, _, err := b.ReadMessage(); err == nil {
+		t.Fatal("group b should not receive the message")
+	}
+
+	// 连接关闭后自动退出分组
+	a1.Close()
+	deadline := time.Now().Add(time.Second)
+	for hub.Count("a") != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("closed connection should leave the group, count %d", hub.Count("a"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// fakeRedis 只支持 PING、SUBSCRIBE、PUBLISH 和 SET NX 的 Redis，用于测试 Hub 的订阅和 nonce 防重放
+type fakeRedis struct {
+	listener net.Listener
+	// failSubscribe 大于 0 时 SUBSCRIBE 返回错误
+	failSubscribe int32
+
+	mu          sync.Mutex
+	subscribers map[string][]net.Conn
+	keys        map[string]bool
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{listener: listener, subscribers: map[string][]net.Conn{}, keys: map[string]bool{}}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	subscribed := false
+	for {
+		args, err := readRESPCommand(reader)
+		if err != nil {
+			return
+		}
+		switch strings.ToLower(args[0]) {
+		case "ping":
+			// 订阅的连接同时会写入消息
+			r.mu.Lock()
+			if subscribed {
+				fmt.Fprint(conn, "*2\r\n$4\r\npong\r\n$0\r\n\r\n")
+			} else {
+				fmt.Fprint(conn, "+PONG\r\n")
+			}
+			r.mu.Unlock()
+		case "subscribe":
+			if atomic.AddInt32(&r.failSubscribe, -1) >= 0 {
+				fmt.Fprint(conn, "-ERR subscribe failed\r\n")
+				continue
+			}
+			subscribed = true
+			r.mu.Lock()
+			for i, channel := range args[1:] {
+				r.subscribers[channel] = append(r.subscribers[channel], conn)
+				fmt.Fprintf(conn, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:%d\r\n", len(channel), channel, i+1)
+			}
+			r.mu.Unlock()
+		case "publish":
+			channel, payload := args[1], args[2]
+			r.mu.Lock()
+			subscribers := r.subscribers[channel]
+			for _, sub := range subscribers {
+				fmt.Fprintf(sub, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(channel), channel, len(payload), payload)
+			}
+			r.mu.Unlock()
+			fmt.Fprintf(conn, ":%d\r\n", len(subscribers))
+		case "set":
+			// 只处理 SET key value ... NX
+			r.mu.Lock()
+			exists := r.keys[args[1]]
+			r.keys[args[1]] = true
+			r.mu.Unlock()
+			if exists {
+				fmt.Fprint(conn, "$-1\r\n")
+			} else {
+				fmt.Fprint(conn, "+OK\r\n")
+			}
+		default:
+			fmt.Fprint(conn, "+OK\r\n")
+		}
+	}
+}
+
+// readRESPCommand 读取 RESP 数组格式的命令
+func readRESPCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestRedisHubBroadcast(t *testing.T) {
+	server := newFakeRedis(t)
+	// 第一次订阅失败
+	server.failSubscribe = 1
+
+	viper.Set("data.redis.hub-test.addr", server.listener.Addr().String())
+	data.InitRedisMgr(map[string]*data.RedisConfig{})
+	defer func() {
+		data.UninitRedisMgr()
+		viper.Set("data.redis", nil)
+	}()
+
+	hub := NewRedisHub("test", "hub-test")
+	defer hub.Close()
+
+	joined := make(chan *WSConn, 2)
+	client := newWSTestServer(t, WebSocketConfig{}, func(conn *WSConn) {
+		hub.Join("a", conn)
+		joined <- conn
+		<-conn.Done()
+	})
+	<-joined
+
+	read := func() string {
+		var msg wsTestMessage
+		_ = client.SetReadDeadline(time.Now().Add(time.Second))
+		if err := client.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg.Text
+	}
+
+	// 订阅失败时 Broadcast 重试订阅
+	if err := hub.Broadcast("a", &wsTestMessage{Text: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	if text := read(); text != "first" {
+		t.Fatalf("got %q", text)
+	}
+
+	// 订阅成功后通过 Redis 收到消息，加入之后立即广播也不会丢失
+	other := newWSTestServer(t, WebSocketConfig{}, func(conn *WSConn) {
+		hub.Join("a", conn)
+		joined <- conn
+		<-conn.Done()
+	})
+	<-joined
+	if err := hub.Broadcast("a", &wsTestMessage{Text: "second"}); err != nil {
+		t.Fatal(err)
+	}
+	if text := read(); text != "second" {
+		t.Fatalf("got %q", text)
+	}
+	var msg wsTestMessage
+	_ = other.SetReadDeadline(time.Now().Add(time.Second))
+	if err := other.ReadJSON(&msg); err != nil || msg.Text != "second" {
+		t.Fatalf("new connection got %q, %v", msg.Text, err)
+	}
+
+	// 当前实例只收到一次
+	_ = client.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, _, err := client.ReadMessage(); err == nil {
+		t.Fatal("message should be delivered once")
+	}
+}
+
+func TestRedisHubUnavailable(t *testing.T) {
+	// Redis 没有配置时广播给当前实例的连接
+	hub := NewRedisHub("test", "not-configured")
+	joined := make(chan struct{}, 1)
+	client := newWSTestServer(t, WebSocketConfig{}, func(conn *WSConn) {
+		hub.Join("a", conn)
+		joined <- struct{}{}
+		<-conn.Done()
+	})
+	<-joined
+
+	if err := hub.Broadcast("a", &wsTestMessage{Text: "local"}); err == nil {
+		t.Fatal("broadcast should report the redis error")
+	}
+	var msg wsTestMessage
+	_ = client.SetReadDeadline(time.Now().Add(time.Second))
+	if err := client.ReadJSON(&msg); err != nil || msg.Text != "local" {
+		t.Fatalf("got %q, %v", msg.Text, err)
+	}
+}
@@ -0,0 +1,217 @@
+// Package health 服务的健康检查，用于 /healthz/live 和 /healthz/ready。
+//
+// 组件通过 Register 注册检查项，默认只用于就绪检查（ready），使用 Liveness 同时用于存活检查（live）。
+// 每个检查项有单独的超时时间，结果在 CacheTTL 内复用，避免探针频繁访问依赖
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 检查结果的状态
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+const (
+	defaultTimeout  = 2 * time.Second
+	defaultCacheTTL = 5 * time.Second
+)
+
+// ErrShuttingDown 服务正在关闭，就绪检查失败
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// CheckFunc 检查函数，返回 nil 表示正常，需要在 ctx 取消后尽快返回
+type CheckFunc func(ctx context.Context) error
+
+// Option 检查项的配置
+type Option func(c *check)
+
+// Timeout 检查的超时时间，默认 2s
+func Timeout(d time.Duration) Option {
+	return func(c *check) {
+		c.timeout = d
+	}
+}
+
+// CacheTTL 检查结果的缓存时间，默认 5s，小于等于 0 时每次都检查
+func CacheTTL(d time.Duration) Option {
+	return func(c *check) {
+		c.cacheTTL = d
+	}
+}
+
+// Liveness 同时用于存活检查，存活检查失败时进程会被重启，只用于进程自身的状态，不要用于外部依赖
+func Liveness() Option {
+	return func(c *check) {
+		c.liveness = true
+	}
+}
+
+// Result 单个检查项的结果
+type Result struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Duration  string    `json:"duration"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// Report 检查的结果，所有检查项都正常时 Status 为 up
+type Report struct {
+	Status string            `json:"status"`
+	Error  string            `json:"error,omitempty"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Up 是否正常
+func (r *Report) Up() bool {
+	return r.Status == StatusUp
+}
+
+type check struct {
+	name     string
+	fn       CheckFunc
+	timeout  time.Duration
+	cacheTTL time.Duration
+	liveness bool
+
+	// mu 同一个检查项同时只执行一次，其他请求等待结果
+	mu     sync.Mutex
+	result Result
+}
+
+var (
+	mutex        sync.RWMutex
+	checks       = map[string]*check{}
+	shuttingDown int32
+)
+
+// Register 注册检查项，名称相同时覆盖之前的检查项
+func Register(name string, fn CheckFunc, opts ...Option) {
+	c := &check{name: name, fn: fn, timeout: defaultTimeout, cacheTTL: defaultCacheTTL}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	checks[name] = c
+}
+
+// Unregister 删除检查项，组件关闭时调用
+func Unregister(name string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	delete(checks, name)
+}
+
+// SetShuttingDown 标记服务正在关闭，之后的就绪检查直接失败，负载均衡不再转发新的请求
+func SetShuttingDown() {
+	atomic.StoreInt32(&shuttingDown, 1)
+}
+
+// IsShuttingDown 服务是否正在关闭
+func IsShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) == 1
+}
+
+// Live 存活检查，只执行 Liveness 的检查项
+func Live(ctx context.Context) *Report {
+	return run(ctx, true)
+}
+
+// Ready 就绪检查，执行所有的检查项，服务关闭时直接失败
+func Ready(ctx context.Context) *Report {
+	report := run(ctx, false)
+	if IsShuttingDown() {
+		report.Status = StatusDown
+		report.Error = ErrShuttingDown.Error()
+	}
+	return report
+}
+
+// run 并发执行检查项
+func run(ctx context.Context, liveness bool) *Report {
+	mutex.RLock()
+	list := make([]*check, 0, len(checks))
+	for _, c := range checks {
+		if !liveness || c.liveness {
+			list = append(list, c)
+		}
+	}
+	mutex.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+
+	results := make([]Result, len(list))
+	var wg sync.WaitGroup
+	for i, c := range list {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			results[i] = c.run(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := &Report{Status: StatusUp, Checks: make(map[string]Result, len(list))}
+	for i, c := range list {
+		report.Checks[c.name] = results[i]
+		if results[i].Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+// run 执行检查，缓存时间内直接返回上次的结果，调用方取消的结果不缓存
+func (c *check) run(ctx context.Context) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.result.CheckedAt.IsZero() && time.Since(c.result.CheckedAt) < c.cacheTTL {
+		return c.result
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.call(checkCtx)
+	result := Result{Status: StatusUp, Duration: time.Since(start).String(), CheckedAt: start}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	// 调用方取消时不是检查项的结果，不缓存
+	if ctx.Err() == nil {
+		c.result = result
+	}
+	return result
+}
+
+// call 检查函数没有处理 ctx 时，超时后不再等待
+func (c *check) call(ctx context.Context) (err error) {
+	ch := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				ch <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		ch <- c.fn(ctx)
+	}()
+
+	select {
+	case err = <-ch:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
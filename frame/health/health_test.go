@@ -0,0 +1,105 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func resetChecks() {
+	mutex.Lock()
+	checks = map[string]*check{}
+	mutex.Unlock()
+	atomic.StoreInt32(&shuttingDown, 0)
+}
+
+func TestReadyAndLive(t *testing.T) {
+	resetChecks()
+	defer resetChecks()
+
+	var dbErr error
+	Register("db.default", func(ctx context.Context) error { return dbErr }, CacheTTL(0))
+	Register("self", func(ctx context.Context) error { return nil }, Liveness())
+
+	if report := Ready(context.Background()); !report.Up() || len(report.Checks) != 2 {
+		t.Fatalf("unexpected ready report %+v", report)
+	}
+
+	dbErr = errors.New("connection refused")
+	report := Ready(context.Background())
+	if report.Up() || report.Checks["db.default"].Error != "connection refused" || report.Checks["self"].Status != StatusUp {
+		t.Fatalf("unexpected ready report %+v", report)
+	}
+
+	// 存活检查不包含外部依赖
+	if report := Live(context.Background()); !report.Up() || len(report.Checks) != 1 {
+		t.Fatalf("unexpected live report %+v", report)
+	}
+
+	Unregister("db.default")
+	if report := Ready(context.Background()); !report.Up() {
+		t.Fatalf("unexpected ready report %+v", report)
+	}
+
+	SetShuttingDown()
+	if report := Ready(context.Background()); report.Up() || report.Error != ErrShuttingDown.Error() {
+		t.Fatalf("ready should fail when shutting down, got %+v", report)
+	}
+	if report := Live(context.Background()); !report.Up() {
+		t.Fatal("live should not be affected by shutdown")
+	}
+}
+
+func TestCheckTimeoutAndCache(t *testing.T) {
+	resetChecks()
+	defer resetChecks()
+
+	var calls int32
+	Register("slow", func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(time.Second)
+		return nil
+	}, Timeout(10*time.Millisecond), CacheTTL(time.Minute))
+	Register("panic", func(ctx context.Context) error { panic("boom") })
+
+	start := time.Now()
+	report := Ready(context.Background())
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("check should not wait after timeout")
+	}
+	if report.Checks["slow"].Error != context.DeadlineExceeded.Error() || report.Checks["panic"].Error != "panic: boom" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	// 缓存时间内复用结果
+	Ready(context.Background())
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("check should be cached, called %d times", n)
+	}
+}
+
+func TestCallerCancelNotCached(t *testing.T) {
+	resetChecks()
+	defer resetChecks()
+
+	Register("db.default", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, Timeout(time.Second), CacheTTL(time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if report := Ready(ctx); report.Checks["db.default"].Error != context.Canceled.Error() {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	// 调用方取消的结果不缓存，下次重新检查
+	mutex.RLock()
+	c := checks["db.default"]
+	mutex.RUnlock()
+	if !c.result.CheckedAt.IsZero() {
+		t.Fatalf("caller cancellation should not be cached: %+v", c.result)
+	}
+}
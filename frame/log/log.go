@@ -85,6 +85,21 @@ func Default() *zap.Logger {
 	return testLogger
 }
 
+// Sync 写入所有日志的缓存，退出之前调用。输出到 stdout 时 Sync 会返回错误，忽略
+func Sync() {
+	synced := make(map[*zap.Logger]bool, len(logMap))
+	for _, logger := range logMap {
+		// 容器中所有的日志使用同一个 Logger
+		if !synced[logger] {
+			synced[logger] = true
+			_ = logger.Sync()
+		}
+	}
+	if testLogger != nil {
+		_ = testLogger.Sync()
+	}
+}
+
 func initLogger(conf *Conf, forceLogStdout bool) *zap.Logger {
 	log := &conf.Logger
 
@@ -8,6 +8,7 @@ import (
 	"github.com/jinzhu/gorm"
 	"github.com/xbonlinenet/goup/frame/alter"
 	"github.com/xbonlinenet/goup/frame/data"
+	"github.com/xbonlinenet/goup/frame/gateway"
 )
 
 // An Option configures
@@ -107,6 +108,13 @@ func CustomRedisConf(conf map[string]*data.RedisConfig) Option {
 	})
 }
 
+// EnableBatchAPI 开启批量接口 /api/_batch，一次请求调用多个接口
+func EnableBatchAPI(batchConfig gateway.BatchConfig) Option {
+	return optionFunc(func(cfg *bootstarpServerConfig) {
+		cfg.batchConfig = &batchConfig
+	})
+}
+
 func SpecifyApiPathPrefix(apiPrefix string) Option {
 	return optionFunc(func(cfg *bootstarpServerConfig) {
 		cfg.customApiPathPrefix = apiPrefix
@@ -7,8 +7,10 @@ import (
 const ReqIdKey = "goup-req-id"
 const ReqLevel = "goup-req-level"
 
+// Deprecated: 调用链通过 OpenTelemetry 记录，见 frame/tracing
 const TraceKafkaTopic = "goup_call_trace"
 
+// Deprecated: 调用链通过 OpenTelemetry 记录，见 frame/tracing
 type Point struct {
 	ReqId    string
 	Server   string
@@ -0,0 +1,150 @@
+package frame
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/xbonlinenet/goup/frame/cc"
+	"github.com/xbonlinenet/goup/frame/log"
+	"github.com/xbonlinenet/goup/frame/tracing"
+)
+
+// 退出各个阶段的默认超时时间，通过 shutdown.* 配置
+const (
+	defaultDrainTimeout  = 5 * time.Second
+	defaultWorkerTimeout = 10 * time.Second
+	defaultFlushTimeout  = 5 * time.Second
+	defaultCloseTimeout  = 10 * time.Second
+)
+
+var (
+	workerMutex  sync.Mutex
+	workerCtx    context.Context
+	workerCancel context.CancelFunc
+	workerGroup  sync.WaitGroup
+	// workerStopping 开始退出后不再启动新的后台任务，避免 workerGroup.Add 和 Wait 并发
+	workerStopping bool
+)
+
+// initWorkerContext 调用方需要持有 workerMutex
+func initWorkerContext() {
+	if workerCtx == nil {
+		workerCtx, workerCancel = context.WithCancel(context.Background())
+	}
+}
+
+// RunWorker 启动后台任务，退出时 ctx 被取消，等待任务返回之后（最多 shutdown.worker_timeout）再关闭数据连接。
+// 开始退出之后启动的任务不会执行。
+//
+//	frame.RunWorker("order-consumer", func(ctx context.Context) {
+//		data.KafkaConsumeV4(ctx, topics, groupID, errCallback, callback, finishCallback)
+//	})
+func RunWorker(name string, fn func(ctx context.Context)) {
+	workerMutex.Lock()
+	defer workerMutex.Unlock()
+	if workerStopping {
+		log.Default().Warn("worker rejected, server is shutting down", zap.String("worker", name))
+		return
+	}
+	initWorkerContext()
+	ctx := workerCtx
+
+	workerGroup.Add(1)
+	go func() {
+		defer workerGroup.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				log.Default().Error("worker panic", zap.String("worker", name), zap.Any("error", err))
+			}
+		}()
+		fn(ctx)
+		log.Default().Info("worker stopped", zap.String("worker", name))
+	}()
+}
+
+// stopWorkers 通知后台任务退出，并等待任务返回
+func stopWorkers(ctx context.Context) error {
+	workerMutex.Lock()
+	workerStopping = true
+	initWorkerContext()
+	workerCancel()
+	workerMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		workerGroup.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shutdownDuration 读取退出阶段的配置
+func shutdownDuration(key string, def time.Duration) time.Duration {
+	key = "shutdown." + key
+	if viper.IsSet(key) {
+		return viper.GetDuration(key)
+	}
+	return def
+}
+
+// runShutdownPhase 执行退出的一个阶段，超时后不再等待，继续执行之后的阶段
+func runShutdownPhase(name string, timeout time.Duration, fn func(ctx context.Context) error) {
+	start := time.Now()
+	log.Default().Info("shutdown phase start", zap.String("phase", name), zap.Duration("timeout", timeout))
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				done <- fmt.Errorf("panic: %v", err)
+			}
+		}()
+		done <- fn(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		log.Default().Warn("shutdown phase failed", zap.String("phase", name), zap.Duration("elapsed", time.Since(start)), zap.Error(err))
+		return
+	}
+	log.Default().Info("shutdown phase done", zap.String("phase", name), zap.Duration("elapsed", time.Since(start)))
+}
+
+// shutdownFramework HTTP 服务停止之后，依次停止后台任务，发送 Kafka 缓存的消息、上报 Span 并写入日志（flush_timeout），
+// 最后按启动相反的顺序停止组件、关闭数据连接（close_timeout）
+func shutdownFramework() {
+	runShutdownPhase("workers", shutdownDuration("worker_timeout", defaultWorkerTimeout), stopWorkers)
+
+	flushTimeout := shutdownDuration("flush_timeout", defaultFlushTimeout)
+	flushComponents(flushTimeout)
+	runShutdownPhase("tracing", flushTimeout, tracing.Shutdown)
+	runShutdownPhase("logger", flushTimeout, func(ctx context.Context) error {
+		log.Sync()
+		return nil
+	})
+
+	closeTimeout := shutdownDuration("close_timeout", defaultCloseTimeout)
+	stopComponents(closeTimeout)
+	runShutdownPhase("config center", closeTimeout, func(ctx context.Context) error {
+		cc.UnInitConfigCenter()
+		return nil
+	})
+}
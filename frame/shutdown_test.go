@@ -0,0 +1,82 @@
+package frame
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func resetWorkers() {
+	workerMutex.Lock()
+	defer workerMutex.Unlock()
+	workerCtx, workerCancel, workerStopping = nil, nil, false
+}
+
+func TestStopWorkers(t *testing.T) {
+	resetWorkers()
+	defer resetWorkers()
+
+	stopped := make(chan struct{})
+	RunWorker("test", func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+
+	runShutdownPhase("workers", time.Second, stopWorkers)
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("worker should be stopped")
+	}
+
+	// 开始退出之后不再启动新的任务
+	started := make(chan struct{}, 1)
+	RunWorker("late", func(ctx context.Context) {
+		started <- struct{}{}
+	})
+	runShutdownPhase("workers", time.Second, stopWorkers)
+	select {
+	case <-started:
+		t.Fatal("worker should be rejected after shutdown started")
+	default:
+	}
+}
+
+func TestShutdownPhaseTimeout(t *testing.T) {
+	start := time.Now()
+	runShutdownPhase("slow", 10*time.Millisecond, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("phase should not wait after timeout")
+	}
+}
+
+func TestShutdownFlushBeforeStop(t *testing.T) {
+	resetComponents()
+	resetWorkers()
+	defer resetComponents()
+	defer resetWorkers()
+
+	var events []string
+	record := func(event string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			events = append(events, event)
+			return nil
+		}
+	}
+	startedComponents = []Component{
+		&dataComponent{name: "db", stop: record("stop db")},
+		&dataComponent{name: "kafka", stop: record("stop kafka"), flush: record("flush kafka")},
+	}
+
+	shutdownFramework()
+
+	// Kafka 缓存的消息在关闭数据连接之前发送
+	expect := []string{"flush kafka", "stop kafka", "stop db"}
+	if !reflect.DeepEqual(events, expect) {
+		t.Fatalf("shutdown order = %v, expect %v", events, expect)
+	}
+}
@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Transport 为每个 http 请求创建 client Span，并在请求头中写入 traceparent
+type Transport struct {
+	// Base 实际发送请求的 RoundTripper，为空时使用 http.DefaultTransport
+	Base http.RoundTripper
+}
+
+// NewTransport 包装 base，base 为空时使用 http.DefaultTransport
+func NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{Base: base}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	ctx, span := Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(req.Method),
+			// 不记录 query，避免泄露参数中的敏感信息
+			semconv.HTTPURLKey.String(req.URL.Scheme+"://"+req.URL.Host+req.URL.Path),
+			semconv.NetPeerNameKey.String(req.URL.Hostname()),
+		))
+	defer span.End()
+
+	// RoundTripper 不能修改原请求
+	req = req.Clone(ctx)
+	InjectHTTP(ctx, req.Header)
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return resp, err
+	}
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
+
+// InjectHTTP 将 ctx 中的 Span 写入请求头
+func InjectHTTP(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// ExtractHTTP 从请求头中读取上游的 Span
+func ExtractHTTP(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
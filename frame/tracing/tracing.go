@@ -0,0 +1,184 @@
+// Package tracing 基于 OpenTelemetry 的链路追踪，通过 W3C traceparent 在服务之间传递。
+//
+// 配置在 application.yml 的 tracing 下，没有开启时 Span 不会被记录，但 traceparent 仍然会透传
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/xbonlinenet/goup/frame/util"
+)
+
+const instrumentationName = "github.com/xbonlinenet/goup"
+
+// 支持的 exporter
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// Config 链路追踪的配置
+type Config struct {
+	Enable bool `mapstructure:"enable"`
+	// ServiceName 服务名称，默认为 application.name
+	ServiceName string `mapstructure:"service_name"`
+	// SampleRatio 采样比例，默认全部采样，上游已经采样的请求始终采样
+	SampleRatio *float64 `mapstructure:"sample_ratio"`
+	// Exporter otlp、stdout 或者 file，默认 otlp
+	Exporter string `mapstructure:"exporter"`
+	// Endpoint OTLP gRPC 的地址，默认 localhost:4317
+	Endpoint string `mapstructure:"endpoint"`
+	// Insecure OTLP 不使用 TLS
+	Insecure bool `mapstructure:"insecure"`
+	// File exporter 为 file 时写入的文件
+	File string `mapstructure:"file"`
+}
+
+var (
+	provider *sdktrace.TracerProvider
+	output   io.Closer
+)
+
+func init() {
+	// 没有开启追踪时也透传 traceparent
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Init 根据 tracing 配置初始化 TracerProvider
+func Init() error {
+	var config Config
+	if err := viper.UnmarshalKey("tracing", &config); err != nil {
+		return err
+	}
+	if !config.Enable {
+		return nil
+	}
+	if config.ServiceName == "" {
+		config.ServiceName = viper.GetString("application.name")
+	}
+
+	exporter, err := newExporter(config)
+	if err != nil {
+		return err
+	}
+
+	ratio := 1.0
+	if config.SampleRatio != nil {
+		ratio = *config.SampleRatio
+	}
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String(config.ServiceName),
+		semconv.HostNameKey.String(util.GetHost()),
+		semconv.ServiceVersionKey.String(util.Version),
+	)
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+	return nil
+}
+
+func newExporter(config Config) (sdktrace.SpanExporter, error) {
+	switch config.Exporter {
+	case "", ExporterOTLP:
+		opts := []otlptracegrpc.Option{}
+		if config.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(config.Endpoint))
+		}
+		if config.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(context.Background(), opts...)
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case ExporterFile:
+		if config.File == "" {
+			return nil, errors.New("tracing.file not configured")
+		}
+		if err := os.MkdirAll(filepath.Dir(config.File), 0750); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(config.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+		if err != nil {
+			return nil, err
+		}
+		output = f
+		return stdouttrace.New(stdouttrace.WithWriter(f))
+	}
+	return nil, fmt.Errorf("unknown tracing exporter: %s", config.Exporter)
+}
+
+// Shutdown 导出剩余的 Span 并关闭 exporter
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+	err := provider.Shutdown(ctx)
+	provider = nil
+	if output != nil {
+		output.Close()
+		output = nil
+	}
+	return err
+}
+
+// Tracer 框架使用的 Tracer
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start 创建 Span，使用完之后需要调用 span.End()
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// End 记录错误并结束 Span
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceID 当前 Span 的 trace id，没有时返回空
+func TraceID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// Detach 只保留 ctx 中的 Span，不继承取消和超时，用于请求结束后还需要继续执行的操作
+func Detach(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+}
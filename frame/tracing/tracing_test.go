@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestProvider() *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	return recorder
+}
+
+func TestTransport(t *testing.T) {
+	recorder := newTestProvider()
+
+	var received context.Context
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = ExtractHTTP(context.Background(), r.Header)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	ctx, parent := Start(context.Background(), "parent")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/path?token=secret", nil)
+	client := &http.Client{Transport: NewTransport(nil)}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	parent.End()
+
+	if req.Header.Get("traceparent") != "" {
+		t.Fatal("original request should not be modified")
+	}
+	if TraceID(received) != TraceID(ctx) {
+		t.Fatalf("trace id not propagated: %q != %q", TraceID(received), TraceID(ctx))
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 || spans[0].Name() != "HTTP GET" || spans[0].SpanKind() != trace.SpanKindClient {
+		t.Fatalf("unexpected spans %v", spans)
+	}
+	if spans[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("client span should be the child of parent")
+	}
+	for _, attr := range spans[0].Attributes() {
+		if attr.Key == "http.url" && attr.Value.AsString() != server.URL+"/path" {
+			t.Fatalf("query should not be recorded: %s", attr.Value.AsString())
+		}
+	}
+}
+
+func TestDetach(t *testing.T) {
+	newTestProvider()
+
+	ctx, span := Start(context.Background(), "parent")
+	defer span.End()
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	detached := Detach(ctx)
+	if detached.Err() != nil {
+		t.Fatal("detached context should not be canceled")
+	}
+	if TraceID(detached) == "" || TraceID(detached) != TraceID(ctx) {
+		t.Fatal("detached context should keep the span")
+	}
+	if TraceID(context.Background()) != "" {
+		t.Fatal("background context should not have trace id")
+	}
+}
@@ -87,3 +87,19 @@ func (lock *DLock) ReleaseLock() (bool, error) {
 	}
 	return false, nil
 }
+
+// Refresh 延长锁的有效期，锁已经过期或者被其他请求持有时返回 false
+func (lock *DLock) Refresh(expire time.Duration) (bool, error) {
+	script := "if redis.call('get', KEYS[1]) == ARGV[1] then return redis.call('pexpire', KEYS[1], ARGV[2]) else return 0 end"
+	key := fmt.Sprintf("dlk:%s", lock.Key)
+	value, err := lock.Cmd.Eval(script, []string{key}, lock.ReqID, expire.Milliseconds()).Result()
+	if err != nil {
+		return false, err
+	}
+
+	count, ok := value.(int64)
+	if !ok {
+		return false, errors.New("redis server reture error")
+	}
+	return count >= 1, nil
+}
@@ -19,10 +19,12 @@ import (
 	"github.com/xbonlinenet/goup/frame/alter"
 	"github.com/xbonlinenet/goup/frame/data"
 	"github.com/xbonlinenet/goup/frame/gateway"
+	"github.com/xbonlinenet/goup/frame/health"
 	"github.com/xbonlinenet/goup/frame/log"
 	"github.com/xbonlinenet/goup/frame/recovery"
 	"github.com/xbonlinenet/goup/frame/util"
 	ginprometheus "github.com/zsais/go-gin-prometheus"
+	"go.uber.org/zap"
 )
 
 func BootstrapServer(ctx context.Context, options ...Option) {
@@ -48,10 +50,8 @@ func BootstrapServer(ctx context.Context, options ...Option) {
 	r := gin.New()
 
 	p := ginprometheus.NewPrometheus("gin")
-	p.ReqCntURLLabelMappingFn = func(c *gin.Context) string {
-		url := c.Request.URL.Path
-		return url
-	}
+	// 使用接口名或者路由模板，避免路径参数导致标签无限增长
+	p.ReqCntURLLabelMappingFn = gateway.MetricsLabel
 
 	p.Use(r)
 
@@ -67,6 +67,10 @@ func BootstrapServer(ctx context.Context, options ...Option) {
 		config.customRouter(r)
 	}
 
+	if config.batchConfig != nil {
+		r.POST(gateway.BatchPath(), gateway.BatchHandler(r, *config.batchConfig))
+	}
+
 	if config.versionHandler != nil {
 		r.GET("/version", config.versionHandler)
 	}
@@ -96,6 +100,8 @@ func BootstrapServer(ctx context.Context, options ...Option) {
 		gin.SetMode("debug")
 		r.GET("/doc/list", gateway.ApiList)
 		r.GET("/doc/detail", gateway.ApiDetail)
+		r.GET("/doc/openapi.json", gateway.OpenAPIJSON)
+		r.GET("/doc/openapi.yaml", gateway.OpenAPIYAML)
 
 		if len(config.reportApiDocAddr) > 0 {
 			addr := viper.GetString("server.addr")
@@ -114,14 +120,11 @@ func BootstrapServer(ctx context.Context, options ...Option) {
 	if config.enableHttpHealthz {
 		r.GET("/system/healthz", gateway.HttpHealthz)
 		r.GET("/healthz", gateway.HttpHealthz)
+		r.GET("/healthz/live", gateway.HttpLiveness)
+		r.GET("/healthz/ready", gateway.HttpReadiness)
 	}
 
-	addr := viper.GetString("server.addr")
-
-	server := &http.Server{
-		Addr:    addr,
-		Handler: r,
-	}
+	server := newHTTPServer(r)
 
 	go server.ListenAndServe()
 
@@ -130,17 +133,27 @@ func BootstrapServer(ctx context.Context, options ...Option) {
 	signal.Notify(ch, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT)
 	sig := <-ch
 	fmt.Println("got a signal", sig)
+	now := time.Now()
+
+	// 退出过程中再次收到信号时强制退出
+	go func() {
+		sig := <-ch
+		fmt.Println("got a signal again, force exit", sig)
+		os.Exit(1)
+	}()
+
+	// 就绪检查立即失败，等待负载均衡摘除实例之后再停止服务
+	health.SetShuttingDown()
+	if delay := shutdownDuration("pre_stop_delay", 0); delay > 0 {
+		log.Default().Info("waiting before shutdown", zap.Duration("delay", delay))
+		time.Sleep(delay)
+	}
+
 	if config.beforeServerExit != nil {
 		fmt.Println("executing hook function，server will be soon shutdown after hook finish")
 		config.beforeServerExit() // 执行hook函数
 	}
-	now := time.Now()
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	err := server.Shutdown(ctx)
-	if err != nil {
-		fmt.Println("shutdown err: ", err)
-	}
+	runShutdownPhase("http", shutdownDuration("drain_timeout", defaultDrainTimeout), server.Shutdown)
 	if config.afterServerExit != nil {
 		fmt.Println("executing hook function，server has shutdown.")
 		config.afterServerExit()
@@ -168,6 +181,28 @@ type bootstarpServerConfig struct {
 	dbErrorCallback     data.DbErrorCallback // DB 错误回调
 	pprofToken          string
 	NotifyFuncHandler   alter.NotifyFunc
+	batchConfig         *gateway.BatchConfig // 批量接口配置，为空时不开启
+}
+
+// newHTTPServer 根据 server.* 配置创建 http.Server，可以设置超时防止慢客户端长时间占用连接
+//
+// 超时没有配置或者为 0 时不限制，和之前的行为相同，max_header_bytes 默认为 1MB。
+// 设置 write_timeout 后流式响应的时间也不能超过该值
+func newHTTPServer(handler http.Handler) *http.Server {
+	maxHeaderBytes := http.DefaultMaxHeaderBytes
+	if viper.IsSet("server.max_header_bytes") {
+		maxHeaderBytes = viper.GetInt("server.max_header_bytes")
+	}
+
+	return &http.Server{
+		Addr:              viper.GetString("server.addr"),
+		Handler:           handler,
+		ReadHeaderTimeout: viper.GetDuration("server.read_header_timeout"),
+		ReadTimeout:       viper.GetDuration("server.read_timeout"),
+		WriteTimeout:      viper.GetDuration("server.write_timeout"),
+		IdleTimeout:       viper.GetDuration("server.idle_timeout"),
+		MaxHeaderBytes:    maxHeaderBytes,
+	}
 }
 
 var httpClient = &http.Client{
@@ -17,6 +17,7 @@ import (
 	"github.com/xbonlinenet/goup/frame/gateway"
 	"github.com/xbonlinenet/goup/frame/log"
 	"github.com/xbonlinenet/goup/frame/perf"
+	"github.com/xbonlinenet/goup/frame/tracing"
 )
 
 // requestLatency 接口延迟
@@ -103,11 +104,12 @@ func initHttpClient() {
 		maxIdleConns := viper.GetInt("xrpc.http.max-idle-conns")
 
 		httpClient = &http.Client{
-			Transport: &http.Transport{
+			// 每个请求创建 client Span，并通过 traceparent 传递给下游
+			Transport: tracing.NewTransport(&http.Transport{
 				MaxIdleConnsPerHost: 20,
 				MaxConnsPerHost:     maxConnsPreHost,
 				MaxIdleConns:        maxIdleConns,
-			},
+			}),
 		}
 	})
 
@@ -115,6 +117,14 @@ func initHttpClient() {
 
 var Json = jsoniter.ConfigCompatibleWithStandardLibrary
 
+// parentContext 只继承 ApiContext 中的 Span，请求的超时时间由 RequestOptions 决定
+func parentContext(c *gateway.ApiContext) context.Context {
+	if c == nil {
+		return context.Background()
+	}
+	return tracing.Detach(c)
+}
+
 // HttpPostWithOptions
 //     headers := map[string]string{"X-Key": "val"}
 //     respBytes, err := HttpPostWithOptions(ctx, url, data, WithTimeout(10*time.Second), WithHeaders(headers))
@@ -135,7 +145,7 @@ func HttpPostRawWithOptions(
 		option.apply(&reqOpts)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), reqOpts.Timeout)
+	ctx, cancel := context.WithTimeout(parentContext(c), reqOpts.Timeout)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBytes))
@@ -208,7 +218,7 @@ func HttpGetWithOptions(c *gateway.ApiContext, url string,
 		option.apply(&reqOpts)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), reqOpts.Timeout)
+	ctx, cancel := context.WithTimeout(parentContext(c), reqOpts.Timeout)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)